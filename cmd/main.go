@@ -1,41 +1,138 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
 
 	"img-to-pdf-converter/internal/config"
 	"img-to-pdf-converter/internal/handlers"
+	"img-to-pdf-converter/internal/logging"
 	"img-to-pdf-converter/internal/services"
+	"img-to-pdf-converter/internal/tracing"
 )
 
 func main() {
-	// Load configuration
-	cfg := config.Load()
-	log.Printf("Starting %s v%s in %s mode at %v PORT", cfg.App.Name, cfg.App.Version, cfg.App.Environment, cfg.Server.Port)
+	configFile := flag.String("config", "", "YAML or TOML config file, CONFIG_FILE by default. Environment variables override its values.")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration with secrets redacted and exit")
+	flag.Parse()
+
+	// Load configuration, invalid settings keep the service from starting
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to print configuration: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Log JSON records, debug records only in debug mode. The standard logger writes through it too.
+	logger := logging.New(cfg, os.Stdout)
+	slog.SetDefault(logger)
+	slog.Info("Starting", "environment", cfg.App.Environment, "port", cfg.Server.Port, "debug", cfg.Server.Debug, "config_file", cfg.File)
+
+	// Trace requests when an exporter is configured, spans are dropped otherwise
+	tracerProvider, err := tracing.New(cfg)
+	if err != nil {
+		fatal("Failed to initialize tracing", err)
+	}
+	tracing.SetTracerProvider(tracerProvider)
+	if tracerProvider != nil {
+		slog.Info("Tracing enabled", "exporter", cfg.Tracing.Exporter, "endpoint", cfg.Tracing.Endpoint, "service_name", cfg.Tracing.ServiceName)
+	}
+
+	// Initialize storage for generated files
+	storage, err := services.NewStorage(cfg)
+	if err != nil {
+		fatal("Failed to initialize storage", err)
+	}
+	// One-time downloads rely on conditional deletes, which not every S3-compatible service honours
+	if s3, ok := storage.(*services.S3Storage); ok {
+		err := s3.CheckConditionalDelete(context.Background())
+		if errors.Is(err, services.ErrConditionalDeleteUnsupported) {
+			fatal("Storage can't serve one-time downloads", err)
+		}
+		if err != nil {
+			slog.Warn("Failed to check conditional deletes of the storage", "error", err)
+		}
+	}
+	slog.Info("Storage initialized", "backend", cfg.Storage.Backend)
 
 	// Initialize services
 	fileService := services.NewFileService(cfg)
-	pdfService := services.NewPDFService(cfg)
+	pdfService := services.NewPDFService(cfg, storage)
+
+	// Load API keys, authentication is only required when keys are configured
+	apiKeys, err := services.NewAPIKeyService(cfg, services.NewMemoryUsageStore())
+	if err != nil {
+		fatal("Failed to load API keys", err)
+	}
+
+	// Conversion slots are shared by all conversion endpoints
+	var conversionLimiter *services.ConversionLimiter
+	if cfg.Limits.MaxConcurrentConversions > 0 {
+		conversionLimiter = services.NewConversionLimiter(cfg.Limits.MaxConcurrentConversions, cfg.Limits.QueueTimeout)
+	}
 
 	// Initialize handlers
-	handler := handlers.NewHandler(cfg, pdfService, fileService)
+	healthChecker := services.NewHealthChecker(cfg, storage, conversionLimiter)
+	handler := handlers.NewHandler(cfg, pdfService, fileService, storage, services.NewDownloadSigner(cfg), healthChecker, conversionLimiter)
 
 	// Create router
 	router := chi.NewRouter()
 
-	// Add middleware
-	router.Use(middleware.Logger)
+	// Add middleware. Every request gets an ID, which is returned in X-Request-ID and logged with
+	// every record of the request, and a server span continuing the caller's trace.
+	router.Use(middleware.RequestID)
+	router.Use(logging.RequestIDResponse)
+	router.Use(tracing.Middleware)
+	router.Use(logging.RequestLogger)
 	router.Use(middleware.Recoverer)
 
-	// Define routes
-	router.Post("/upload", handler.UploadHandler)
+	// Define routes. Conversions are rate limited per client IP and need an API key when keys are
+	// configured. The handlers take one of the limited conversion slots once the request is read.
+	router.Group(func(r chi.Router) {
+		if cfg.Limits.RequestsPerMinute > 0 {
+			r.Use(handler.RateLimit(services.NewRateLimiter(cfg.Limits.RequestsPerMinute, cfg.Limits.Burst)))
+		}
+		if apiKeys.Enabled() {
+			r.Use(handler.APIKeyAuth(apiKeys))
+		}
+		r.Post("/upload", handler.UploadHandler)
+		r.Post("/upload/batch", handler.BatchUploadHandler)
+		r.Post("/convert", handler.ConvertJSONHandler)
+		r.Post("/convert/url", handler.ConvertURLHandler)
+		r.Post("/pdf-to-images", handler.PDFToImagesHandler)
+	})
+	// Download links are signed, so they work without a key
 	router.Get("/download", handler.DownloadHandler)
-	router.Get("/health", handler.HealthHandler)
+	// Liveness only tells that the process is up, readiness checks directories, disk, the
+	// conversion queue and storage. /health is kept for existing health checks.
+	router.Get("/health/live", handler.LivenessHandler)
+	router.Get("/health/ready", handler.ReadinessHandler)
+	router.Get("/health", handler.ReadinessHandler)
+	if cfg.Metrics.Enabled {
+		router.Method(http.MethodGet, "/metrics", promhttp.Handler())
+		slog.Info("Prometheus metrics enabled", "path", "/metrics")
+	}
 
 	// Add a simple root endpoint
 	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
@@ -49,7 +146,9 @@ func main() {
 		AllowedOrigins:   cfg.CORS.AllowedOrigins,
 		AllowedMethods:   cfg.CORS.AllowedMethods,
 		AllowedHeaders:   cfg.CORS.AllowedHeaders,
-		AllowCredentials: true,
+		ExposedHeaders:   cfg.CORS.ExposedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           int(cfg.CORS.MaxAge.Seconds()),
 		Debug:            cfg.Server.Debug,
 	})
 
@@ -58,23 +157,103 @@ func main() {
 
 	// Ensure required directories exist
 	if err := fileService.EnsureDirectoryExists(cfg.Upload.TempDir); err != nil {
-		log.Fatalf("Failed to create temp directory: %v", err)
+		fatal("Failed to create temp directory", err)
 	}
 	if err := fileService.EnsureDirectoryExists(cfg.Upload.UploadDir); err != nil {
-		log.Fatalf("Failed to create upload directory: %v", err)
-	}
-	if err := fileService.EnsureDirectoryExists(cfg.PDF.OutputDir); err != nil {
-		log.Fatalf("Failed to create output directory: %v", err)
+		fatal("Failed to create upload directory", err)
 	}
 
+	// Remove expired outputs and temp files left over from crashes, now and periodically
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	defer stopJanitor()
+	janitor := services.NewJanitor(cfg, storage, fileService)
+	janitor.Start(janitorCtx)
+	slog.Info("Janitor started", "output_ttl", cfg.Janitor.OutputTTL, "temp_max_age", cfg.Janitor.TempMaxAge, "interval", cfg.Janitor.Interval)
+
 	// Start server
 	serverAddr := ":" + cfg.Server.Port
-	log.Printf("Server starting on http://%s", serverAddr)
-	log.Printf("CORS allowed origins: %v", cfg.CORS.AllowedOrigins)
-	log.Printf("Upload config: MaxFileSize=%d bytes, MaxFiles=%d", cfg.Upload.MaxFileSize, cfg.Upload.MaxFiles)
-	log.Printf("Allowed file types: %v", cfg.Upload.AllowedTypes)
+	slog.Info("Server starting", "addr", serverAddr)
+	slog.Info("CORS configured", "allowed_origins", cfg.CORS.AllowedOrigins, "allowed_headers", cfg.CORS.AllowedHeaders, "allow_credentials", cfg.CORS.AllowCredentials)
+	slog.Info("Upload limits", "max_file_size", cfg.Upload.MaxFileSize, "max_type_sizes", cfg.Upload.MaxTypeSizes,
+		"max_request_size", cfg.Upload.MaxRequestSize, "max_files", cfg.Upload.MaxFiles,
+		"max_image_width", cfg.Upload.MaxImageWidth, "max_image_height", cfg.Upload.MaxImageHeight,
+		"allowed_types", cfg.Upload.AllowedTypes)
+	slog.Info("Shutdown configured", "delay", cfg.Server.ShutdownDelay, "timeout", cfg.Server.ShutdownTimeout)
+	slog.Info("Rate limits", "requests_per_minute", cfg.Limits.RequestsPerMinute, "burst", cfg.Limits.Burst, "max_concurrent_conversions", cfg.Limits.MaxConcurrentConversions)
 
-	if err := http.ListenAndServe(serverAddr, handler_with_cors); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	// Requests derive their context from this one, cancelling it aborts the running conversions
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	server := &http.Server{
+		Addr:    serverAddr,
+		Handler: handler_with_cors,
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Wait for SIGINT or SIGTERM, e.g. from docker during a rolling update
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	select {
+	case err := <-serverErr:
+		fatal("Server failed to start", err)
+	case <-signalCtx.Done():
 	}
+	// A second signal kills the process right away
+	stopSignals()
+
+	// Report not ready first, so load balancers stop sending new requests before the listener closes
+	slog.Info("Shutting down, draining", "delay", cfg.Server.ShutdownDelay)
+	handler.StartDraining()
+	time.Sleep(cfg.Server.ShutdownDelay)
+
+	// Requests waiting for a conversion slot would not finish in time, they are failed with a 503 right away
+	if conversionLimiter != nil {
+		conversionLimiter.Close()
+	}
+
+	// Let the running conversions finish. Those still running at the timeout are cancelled,
+	// which removes their partial outputs and temp files.
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Requests still running, cancelling them", "timeout", cfg.Server.ShutdownTimeout)
+		cancelRequests()
+
+		cleanupCtx, cancelCleanup := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelCleanup()
+		if err := server.Shutdown(cleanupCtx); err != nil {
+			server.Close()
+		}
+	}
+	if err := <-serverErr; !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Server error", "error", err)
+	}
+
+	stopJanitor()
+
+	// Send the spans of the last requests
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if tracerProvider != nil {
+		if err := tracerProvider.Shutdown(flushCtx); err != nil {
+			slog.Warn("Failed to flush spans", "error", err)
+		}
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs an error that keeps the service from running and exits
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
 }
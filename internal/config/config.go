@@ -1,50 +1,171 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
-	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 // Config holds all application configuration
 type Config struct {
-	Server ServerConfig
-	CORS   CORSConfig
-	Upload UploadConfig
-	PDF    PDFConfig
-	App    AppConfig
+	File     string // Config file the values were read from, empty when there is none
+	Server   ServerConfig
+	CORS     CORSConfig
+	Upload   UploadConfig
+	PDF      PDFConfig
+	Storage  StorageConfig
+	Janitor  JanitorConfig
+	Download DownloadConfig
+	Auth     AuthConfig
+	Limits   LimitsConfig
+	Metrics  MetricsConfig
+	Tracing  TracingConfig
+	Health   HealthConfig
+	Fetch    FetchConfig
+	App      AppConfig
 }
 
 // ServerConfig holds server-related configuration
 type ServerConfig struct {
-	Port  string
-	Host  string
-	Debug bool
+	Port            string
+	Host            string
+	Debug           bool
+	ShutdownDelay   time.Duration // How long the instance reports not ready before it stops accepting connections
+	ShutdownTimeout time.Duration // How long in-flight requests may take to finish on shutdown
 }
 
 // CORSConfig holds CORS-related configuration
 type CORSConfig struct {
-	AllowedOrigins []string
-	AllowedMethods []string
-	AllowedHeaders []string
+	AllowedOrigins   []string // Exact origins or patterns with one wildcard such as https://*.example.com, "*" allows any origin
+	AllowedMethods   []string
+	AllowedHeaders   []string // Request headers browsers may send, "*" allows any
+	ExposedHeaders   []string // Response headers scripts may read
+	AllowCredentials bool
+	MaxAge           time.Duration // How long browsers may cache preflight responses
 }
 
 // UploadConfig holds upload-related configuration
 type UploadConfig struct {
-	MaxFileSize  int64
-	MaxFiles     int
-	AllowedTypes []string
-	TempDir      string
-	UploadDir    string
+	MaxFileSize        int64
+	MaxTypeSizes       map[string]int64 // Maximum file sizes by content type, replacing MaxFileSize for those types
+	MaxRequestSize     int64            // Maximum combined size of the files of one request
+	MaxFiles           int
+	MaxBatchGroups     int
+	MaxArchiveSize     int64
+	MaxArchiveEntries  int
+	MaxArchiveDepth    int
+	MaxImageWidth      int // Maximum declared image dimensions in pixels, checked before decoding
+	MaxImageHeight     int
+	MaxImageMegapixels float64 // Maximum declared width times height in millions of pixels
+	AllowedTypes       []string
+	TempDir            string
+	UploadDir          string
+}
+
+// MaxSizeFor returns the maximum size in bytes of a file with the given content type
+func (u UploadConfig) MaxSizeFor(contentType string) int64 {
+	if size, ok := u.MaxTypeSizes[contentType]; ok {
+		return size
+	}
+	return u.MaxFileSize
+}
+
+// LargestFileSize returns the maximum size in bytes of a file of any type, for reading
+// data before its type is known
+func (u UploadConfig) LargestFileSize() int64 {
+	largest := u.MaxFileSize
+	for _, size := range u.MaxTypeSizes {
+		if size > largest {
+			largest = size
+		}
+	}
+	return largest
 }
 
 // PDFConfig holds PDF generation configuration
 type PDFConfig struct {
-	OutputDir   string
-	PageFormat  string
-	Orientation string
-	Unit        string
+	OutputDir         string
+	PageFormat        string // Page size of PDF output, e.g. A4 or Letter
+	Orientation       string // Default page orientation, P or L
+	RasterizerPath    string
+	DefaultRasterDPI  int
+	MaxRasterDPI      int
+	ConversionTimeout time.Duration
+}
+
+// StorageConfig holds configuration for the storage backend of generated files
+type StorageConfig struct {
+	Backend     string // filesystem, memory or s3
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3Prefix    string
+	S3AccessKey string
+	S3SecretKey string
+	S3Timeout   time.Duration // Limit for connecting to S3 and waiting for response headers
+}
+
+// JanitorConfig holds configuration for the cleanup of expired outputs and stale temp files
+type JanitorConfig struct {
+	OutputTTL  time.Duration // Generated files are deleted after this long, never when zero
+	TempMaxAge time.Duration // Temp files of conversions older than this are left over from crashes
+	Interval   time.Duration
+}
+
+// DownloadConfig holds configuration for the signed download links of generated files
+type DownloadConfig struct {
+	SigningSecret string
+	LinkTTL       time.Duration
+}
+
+// AuthConfig holds configuration for API key authentication, which is enabled when any key is configured.
+// Zero limits are unlimited.
+type AuthConfig struct {
+	KeysFile                string   // JSON file with keys and their limits
+	Keys                    []string // Additional keys as name:key pairs, using the default limits
+	DefaultDailyConversions int
+	DefaultDailyBytes       int64
+	DefaultMaxPages         int
+}
+
+// LimitsConfig holds the per-client rate limits and the global cap on concurrent conversions.
+// Zero values disable a limit.
+type LimitsConfig struct {
+	RequestsPerMinute        float64       // Sustained conversion requests per client IP
+	Burst                    int           // Requests a client IP may make at once
+	MaxConcurrentConversions int           // Conversions running at the same time across all clients
+	QueueTimeout             time.Duration // How long a request waits for a free conversion slot
+	TrustedProxies           []string      // CIDRs whose X-Forwarded-For header is trusted
+}
+
+// MetricsConfig holds configuration for the Prometheus metrics endpoint
+type MetricsConfig struct {
+	Enabled bool
+}
+
+// TracingConfig holds configuration for OpenTelemetry tracing, read from the standard OTEL_* variables
+type TracingConfig struct {
+	Exporter    string   // "otlp" sends spans to an OTLP/HTTP collector, "none" (default) disables tracing
+	Endpoint    string   // URL spans are posted to
+	Headers     []string // Extra request headers as key=value, e.g. for collector authentication
+	ServiceName string
+}
+
+// HealthConfig holds the thresholds of the readiness check
+type HealthConfig struct {
+	MinFreeDisk          int64         // Free bytes required on the temp, upload and output filesystems
+	MaxQueuedConversions int           // Requests waiting for a conversion slot before the instance reports not ready
+	CheckTimeout         time.Duration // Deadline for the storage check
+}
+
+// FetchConfig holds configuration for downloading images from URLs
+type FetchConfig struct {
+	Timeout              time.Duration
+	MaxRedirects         int
+	AllowPrivateNetworks bool
 }
 
 // AppConfig holds general application configuration
@@ -54,68 +175,141 @@ type AppConfig struct {
 	Environment string
 }
 
-// Load creates and returns a new Config instance with values from environment variables or defaults
-func Load() *Config {
+// Load returns the configuration from the defaults, the optional config file and the environment,
+// in increasing order of precedence. Without a path the file named by CONFIG_FILE is read, if any.
+// Values that don't parse and settings that fail validation are errors.
+func Load(path string) (*Config, error) {
 	godotenv.Load()
+
+	cfg := defaults()
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	// Both layers are read before returning, so all invalid values are reported at once
+	var fileErr error
+	if path != "" {
+		fileErr = loadFile(cfg, path)
+		cfg.File = path
+	}
+	if err := errors.Join(fileErr, loadEnv(cfg)); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// defaultFrontendURL is the origin of the frontend's development server, replaced by FRONTEND_URL
+const defaultFrontendURL = "http://localhost:3000"
+
+// defaults returns the configuration used when nothing is set
+func defaults() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port:  getEnvOrDefault("PORT", "8080"),
-			Host:  getEnvOrDefault("HOST", "localhost"),
-			Debug: getEnvBoolOrDefault("DEBUG", true),
+			Port:            "8080",
+			Host:            "localhost",
+			Debug:           true,
+			ShutdownDelay:   5 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
 		},
 		CORS: CORSConfig{
-			AllowedOrigins: []string{
-				getEnvOrDefault("FRONTEND_URL", "http://localhost:3000"),
-				"http://127.0.0.1:3000",
-				"http://localhost:3001",
-				"http://127.0.0.1:3001",
-			},
-			AllowedMethods: []string{"GET", "POST", "OPTIONS"},
-			AllowedHeaders: []string{"*"},
+			AllowedOrigins:   []string{defaultFrontendURL, "http://127.0.0.1:3000", "http://localhost:3001", "http://127.0.0.1:3001"},
+			AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+			AllowedHeaders:   []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID", "traceparent"},
+			ExposedHeaders:   []string{"Content-Disposition", "X-Request-ID", "Retry-After"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
 		},
 		Upload: UploadConfig{
-			MaxFileSize:  getEnvIntOrDefault("MAX_FILE_SIZE", 10*1024*1024), // 10MB
-			MaxFiles:     int(getEnvIntOrDefault("MAX_FILES", 10)),
-			AllowedTypes: []string{"image/jpeg", "image/png", "image/gif", "image/bmp", "image/webp"},
-			TempDir:      getEnvOrDefault("TEMP_DIR", "./temp"),
-			UploadDir:    getEnvOrDefault("UPLOAD_DIR", "./uploads"),
+			MaxFileSize:        10 * 1024 * 1024, // 10MB
+			MaxTypeSizes:       map[string]int64{},
+			MaxRequestSize:     100 * 1024 * 1024, // 100MB
+			MaxFiles:           10,
+			MaxBatchGroups:     20,
+			MaxArchiveSize:     100 * 1024 * 1024, // 100MB decompressed
+			MaxArchiveEntries:  100,
+			MaxArchiveDepth:    2,
+			MaxImageWidth:      20000,
+			MaxImageHeight:     20000,
+			MaxImageMegapixels: 100,
+			AllowedTypes: []string{
+				"image/jpeg", "image/png", "image/gif", "image/bmp", "image/webp",
+				"application/pdf", "application/zip", "application/x-zip-compressed",
+			},
+			TempDir:   "./temp",
+			UploadDir: "./uploads",
 		},
 		PDF: PDFConfig{
-			OutputDir:   getEnvOrDefault("PDF_OUTPUT_DIR", "./output"),
-			PageFormat:  getEnvOrDefault("PDF_PAGE_FORMAT", "A4"),
-			Orientation: getEnvOrDefault("PDF_ORIENTATION", "P"),
-			Unit:        getEnvOrDefault("PDF_UNIT", "mm"),
+			OutputDir:         "./output",
+			PageFormat:        "A4",
+			Orientation:       "P",
+			RasterizerPath:    "pdftoppm",
+			DefaultRasterDPI:  150,
+			MaxRasterDPI:      600,
+			ConversionTimeout: 2 * time.Minute,
+		},
+		Storage: StorageConfig{
+			Backend:   "filesystem",
+			S3Region:  "us-east-1",
+			S3Timeout: 30 * time.Second,
+		},
+		Janitor: JanitorConfig{
+			OutputTTL:  24 * time.Hour,
+			TempMaxAge: time.Hour,
+			Interval:   10 * time.Minute,
+		},
+		Download: DownloadConfig{
+			LinkTTL: time.Hour,
+		},
+		Limits: LimitsConfig{
+			RequestsPerMinute:        30,
+			Burst:                    10,
+			MaxConcurrentConversions: 4,
+			QueueTimeout:             10 * time.Second,
+			TrustedProxies: []string{
+				"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16",
+			},
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Endpoint:    "http://localhost:4318/v1/traces",
+			ServiceName: "img-to-pdf-converter",
+		},
+		Health: HealthConfig{
+			MinFreeDisk:          500 * 1024 * 1024, // 500MB
+			MaxQueuedConversions: 8,
+			CheckTimeout:         2 * time.Second,
+		},
+		Fetch: FetchConfig{
+			Timeout:      15 * time.Second,
+			MaxRedirects: 3,
 		},
 		App: AppConfig{
-			Name:        getEnvOrDefault("APP_NAME", "Image to PDF Converter"),
-			Version:     getEnvOrDefault("APP_VERSION", "1.0.0"),
-			Environment: getEnvOrDefault("ENVIRONMENT", "development"),
+			Name:        "Image to PDF Converter",
+			Version:     "1.0.0",
+			Environment: "development",
 		},
 	}
 }
 
-// Helper functions for environment variables
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
-func getEnvBoolOrDefault(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		if boolVal, err := strconv.ParseBool(value); err == nil {
-			return boolVal
+// loadEnv applies the environment variables of all settings. Empty variables are ignored, as if
+// they were unset, so a blank line in a .env file or compose file keeps the default. Lists such as
+// the trusted proxies can only be emptied in a config file, e.g. with trusted_proxies: [].
+func loadEnv(cfg *Config) error {
+	var errs []error
+	for _, s := range settings {
+		if s.env == "" {
+			continue
 		}
-	}
-	return defaultValue
-}
-
-func getEnvIntOrDefault(key string, defaultValue int64) int64 {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
-			return intVal
+		value := os.Getenv(s.env)
+		if value == "" {
+			continue
+		}
+		if err := s.setString(cfg, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", s.env, err))
 		}
 	}
-	return defaultValue
+	return errors.Join(errs...)
 }
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCORSOrigins(t *testing.T) {
+	tests := []struct {
+		name           string
+		frontendURL    string
+		allowedOrigins string
+		want           []string
+	}{
+		{
+			name: "defaults",
+			want: []string{"http://localhost:3000", "http://127.0.0.1:3000", "http://localhost:3001", "http://127.0.0.1:3001"},
+		},
+		{
+			name:        "frontend URL replaces the default frontend",
+			frontendURL: "https://app.example.com",
+			want:        []string{"https://app.example.com", "http://127.0.0.1:3000", "http://localhost:3001", "http://127.0.0.1:3001"},
+		},
+		{
+			name:        "frontend URL already allowed",
+			frontendURL: "http://localhost:3001",
+			want:        []string{"http://localhost:3001", "http://127.0.0.1:3000", "http://127.0.0.1:3001"},
+		},
+		{
+			name:           "allowed origins take precedence",
+			frontendURL:    "https://app.example.com",
+			allowedOrigins: "https://a.example.com,https://b.example.com",
+			want:           []string{"https://a.example.com", "https://b.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FRONTEND_URL", tt.frontendURL)
+			t.Setenv("CORS_ALLOWED_ORIGINS", tt.allowedOrigins)
+
+			cfg := defaults()
+			if err := loadEnv(cfg); err != nil {
+				t.Fatalf("loadEnv() error = %v", err)
+			}
+			if !slices.Equal(cfg.CORS.AllowedOrigins, tt.want) {
+				t.Errorf("allowed origins = %v, want %v", cfg.CORS.AllowedOrigins, tt.want)
+			}
+		})
+	}
+}
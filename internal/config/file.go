@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// loadFile applies the settings of a YAML or TOML file, picked by its extension.
+// Keys that are not settings are errors, so typos don't go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		if err := decoder.Decode(&values); err != nil && err != io.EOF {
+			return fmt.Errorf("invalid config file %s: %v", path, err)
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(data), &values); err != nil {
+			return fmt.Errorf("invalid config file %s: %v", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file %s, expected .yaml, .yml or .toml", path)
+	}
+
+	byKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		if s.key != "" {
+			byKey[s.key] = s
+		}
+	}
+
+	var errs []error
+	for _, entry := range flatten("", values, byKey) {
+		s, ok := byKey[entry.key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %s", path, entry.key))
+			continue
+		}
+		if err := s.setValue(cfg, entry.value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %v", path, entry.key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fileEntry is a value of a config file with its dotted key
+type fileEntry struct {
+	key   string
+	value any
+}
+
+// flatten turns nested sections into dotted keys, sorted so errors come out in a stable order.
+// Maps that are the value of a setting are kept whole.
+func flatten(prefix string, values map[string]any, byKey map[string]setting) []fileEntry {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var entries []fileEntry
+	for _, key := range keys {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		if _, isSetting := byKey[name]; !isSetting {
+			if section, ok := values[key].(map[string]any); ok {
+				entries = append(entries, flatten(name, section, byKey)...)
+				continue
+			}
+		}
+		entries = append(entries, fileEntry{key: name, value: values[key]})
+	}
+	return entries
+}
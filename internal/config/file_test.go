@@ -0,0 +1,205 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a config file with the given name into a temp dir and returns its path
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+server:
+  port: 9090
+  debug: false
+upload:
+  max_file_size: 20MB
+  max_request_size: 1048576
+  max_type_sizes:
+    image/gif: 2MB
+    image/jpeg: 4194304
+  max_image_megapixels: 50
+  allowed_types: [image/png, image/gif, image/jpeg]
+pdf:
+  page_format: Letter
+  conversion_timeout: 90s
+janitor:
+  output_ttl: 7d
+limits:
+  trusted_proxies: []
+`,
+		"config.toml": `
+[server]
+port = 9090
+debug = false
+
+[upload]
+max_file_size = "20MB"
+max_request_size = 1048576
+max_type_sizes = { "image/gif" = "2MB", "image/jpeg" = 4194304 }
+max_image_megapixels = 50
+allowed_types = ["image/png", "image/gif", "image/jpeg"]
+
+[pdf]
+page_format = "Letter"
+conversion_timeout = "90s"
+
+[janitor]
+output_ttl = "7d"
+
+[limits]
+trusted_proxies = []
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaults()
+			if err := loadFile(cfg, writeConfigFile(t, name, content)); err != nil {
+				t.Fatalf("loadFile() error = %v", err)
+			}
+
+			if cfg.Server.Port != "9090" || cfg.Server.Debug {
+				t.Errorf("server = %+v, want port 9090 without debug", cfg.Server)
+			}
+			if cfg.Upload.MaxFileSize != 20<<20 || cfg.Upload.MaxRequestSize != 1<<20 {
+				t.Errorf("sizes = %d, %d, want %d, %d", cfg.Upload.MaxFileSize, cfg.Upload.MaxRequestSize, 20<<20, 1<<20)
+			}
+			if cfg.Upload.MaxTypeSizes["image/gif"] != 2<<20 || cfg.Upload.MaxTypeSizes["image/jpeg"] != 4<<20 || len(cfg.Upload.MaxTypeSizes) != 2 {
+				t.Errorf("max type sizes = %v", cfg.Upload.MaxTypeSizes)
+			}
+			if cfg.Upload.MaxImageMegapixels != 50 {
+				t.Errorf("max image megapixels = %v, want 50", cfg.Upload.MaxImageMegapixels)
+			}
+			if want := []string{"image/png", "image/gif", "image/jpeg"}; !slices.Equal(cfg.Upload.AllowedTypes, want) {
+				t.Errorf("allowed types = %v, want %v", cfg.Upload.AllowedTypes, want)
+			}
+			if cfg.PDF.PageFormat != "Letter" || cfg.PDF.ConversionTimeout != 90*time.Second {
+				t.Errorf("pdf = %+v, want Letter pages and a 90s timeout", cfg.PDF)
+			}
+			if cfg.Janitor.OutputTTL != 7*24*time.Hour {
+				t.Errorf("output TTL = %v, want 7 days", cfg.Janitor.OutputTTL)
+			}
+			// An empty list in the file replaces the default
+			if cfg.Limits.TrustedProxies == nil || len(cfg.Limits.TrustedProxies) != 0 {
+				t.Errorf("trusted proxies = %#v, want an empty list", cfg.Limits.TrustedProxies)
+			}
+			// Settings missing from the file keep their defaults
+			if cfg.Upload.MaxFiles != defaults().Upload.MaxFiles {
+				t.Errorf("max files = %d, want the default %d", cfg.Upload.MaxFiles, defaults().Upload.MaxFiles)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "unknown keys",
+			file:    "config.yaml",
+			content: "server:\n  prot: 9090\nuploads:\n  max_files: 3\n",
+			want:    []string{"unknown setting server.prot", "unknown setting uploads.max_files"},
+		},
+		{
+			name:    "invalid values",
+			file:    "config.yaml",
+			content: "upload:\n  max_file_size: ten megabytes\n  max_files: 2.5\npdf:\n  conversion_timeout: 90\nserver:\n  debug: maybe\n",
+			want: []string{
+				"upload.max_file_size: invalid size",
+				"upload.max_files: expected a whole number",
+				"pdf.conversion_timeout: expected a duration",
+				"server.debug: invalid boolean",
+			},
+		},
+		{
+			name:    "invalid TOML values",
+			file:    "config.toml",
+			content: "[upload]\nallowed_types = \"image/png\"\nmax_type_sizes = [\"image/gif=2MB\"]\n",
+			want:    []string{"upload.max_type_sizes: expected a map of sizes"},
+		},
+		{
+			name:    "invalid YAML",
+			file:    "config.yaml",
+			content: "server:\n  port: [9090\n",
+			want:    []string{"invalid config file"},
+		},
+		{
+			name:    "invalid TOML",
+			file:    "config.toml",
+			content: "[server\nport = 9090\n",
+			want:    []string{"invalid config file"},
+		},
+		{
+			name:    "unsupported extension",
+			file:    "config.json",
+			content: "{}",
+			want:    []string{"unsupported config file", "expected .yaml, .yml or .toml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadFile(defaults(), writeConfigFile(t, tt.file, tt.content))
+			if err == nil {
+				t.Fatal("loadFile() error = nil, want an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("loadFile() error = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFileEmpty(t *testing.T) {
+	for _, name := range []string{"empty.yaml", "empty.toml"} {
+		cfg := defaults()
+		if err := loadFile(cfg, writeConfigFile(t, name, "")); err != nil {
+			t.Errorf("loadFile(%s) error = %v", name, err)
+		}
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "upload:\n  max_files: 3\n  max_file_size: 1MB\nlimits:\n  trusted_proxies: [10.0.0.0/8]\n")
+	t.Setenv("MAX_FILES", "7")
+	// Empty variables are ignored like unset ones
+	t.Setenv("MAX_FILE_SIZE", "")
+	t.Setenv("TRUSTED_PROXIES", "")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Upload.MaxFiles != 7 {
+		t.Errorf("max files = %d, want 7 from the environment", cfg.Upload.MaxFiles)
+	}
+	if cfg.Upload.MaxFileSize != 1<<20 {
+		t.Errorf("max file size = %d, want %d from the file", cfg.Upload.MaxFileSize, 1<<20)
+	}
+	if want := []string{"10.0.0.0/8"}; !slices.Equal(cfg.Limits.TrustedProxies, want) {
+		t.Errorf("trusted proxies = %v, want %v from the file", cfg.Limits.TrustedProxies, want)
+	}
+	if cfg.File != path {
+		t.Errorf("file = %q, want %q", cfg.File, path)
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the values of secret settings when the configuration is printed
+const redacted = "[redacted]"
+
+// Print writes the effective configuration to w as a YAML config file, with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	if c.File != "" {
+		if _, err := io.WriteString(w, "# Loaded from "+c.File+" and the environment\n"); err != nil {
+			return err
+		}
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := map[string]*yaml.Node{}
+	for _, s := range settings {
+		if s.key == "" {
+			continue
+		}
+		sectionName, name, _ := strings.Cut(s.key, ".")
+		section, ok := sections[sectionName]
+		if !ok {
+			section = &yaml.Node{Kind: yaml.MappingNode}
+			sections[sectionName] = section
+			root.Content = append(root.Content, scalarNode(sectionName), section)
+		}
+		section.Content = append(section.Content, scalarNode(name), s.node(c))
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// node returns the YAML value of the setting, in a form Load reads back
+func (s setting) node(c *Config) *yaml.Node {
+	switch field := s.field(c).(type) {
+	case *string:
+		if s.secret && *field != "" {
+			return scalarNode(redacted)
+		}
+		return scalarNode(*field)
+	case *bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(*field)}
+	case *int:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(*field)}
+	case *int64:
+		if size := FormatSize(*field); size != strconv.FormatInt(*field, 10) {
+			return scalarNode(size)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatInt(*field, 10)}
+	case *float64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: strconv.FormatFloat(*field, 'f', -1, 64)}
+	case *time.Duration:
+		return scalarNode(FormatDuration(*field))
+	case *[]string:
+		list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range *field {
+			if s.secret {
+				item = redacted
+			}
+			list.Content = append(list.Content, scalarNode(item))
+		}
+		return list
+	case *map[string]int64:
+		names := make([]string, 0, len(*field))
+		for name := range *field {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		sizes := &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+		for _, name := range names {
+			sizes.Content = append(sizes.Content, scalarNode(name), scalarNode(FormatSize((*field)[name])))
+		}
+		return sizes
+	}
+	return scalarNode("")
+}
+
+// FormatDuration formats a duration like time.Duration.String without trailing zero units,
+// e.g. "2m" instead of "2m0s", and whole days as "7d"
+func FormatDuration(d time.Duration) string {
+	day := 24 * time.Hour
+	if d >= day && d%day == 0 {
+		return strconv.FormatInt(int64(d/day), 10) + "d"
+	}
+	text := d.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// scalarNode returns a string node
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
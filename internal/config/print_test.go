@@ -0,0 +1,84 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := defaults()
+	cfg.File = "config.yaml"
+	cfg.Storage.S3AccessKey = "AKIAEXAMPLE"
+	cfg.Storage.S3SecretKey = "s3-secret-value"
+	cfg.Download.SigningSecret = "signing-secret-value"
+	cfg.Auth.Keys = []string{"ci:key-one-value", "web:key-two-value"}
+	cfg.Tracing.Headers = []string{"authorization=Bearer collector-token"}
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+	output := buf.String()
+
+	for _, secret := range []string{"AKIAEXAMPLE", "s3-secret-value", "signing-secret-value", "key-one-value", "key-two-value", "collector-token"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("printed configuration contains the secret %q:\n%s", secret, output)
+		}
+	}
+	for _, line := range []string{
+		"# Loaded from config.yaml and the environment",
+		"  s3_secret_key: '[redacted]'",
+		"  signing_secret: '[redacted]'",
+		"  keys: ['[redacted]', '[redacted]']",
+		"  headers: ['[redacted]']",
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("printed configuration has no line %q:\n%s", line, output)
+		}
+	}
+}
+
+func TestPrintKeepsUnsetSecretsEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := defaults().Print(&buf); err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+	// Redacting empty secrets would hide that they are not set
+	if strings.Contains(buf.String(), redacted) {
+		t.Errorf("printed default configuration redacts unset secrets:\n%s", buf.String())
+	}
+}
+
+func TestPrintedConfigLoadsBack(t *testing.T) {
+	cfg := defaults()
+	cfg.Upload.MaxTypeSizes = map[string]int64{"image/gif": 2 << 20, "image/jpeg": 1500}
+	cfg.Upload.MaxImageMegapixels = 12.5
+	cfg.PDF.PageFormat = "Legal"
+	cfg.Janitor.OutputTTL = 72 * time.Hour
+	cfg.Limits.TrustedProxies = []string{}
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+
+	loaded := defaults()
+	if err := loadFile(loaded, writeConfigFile(t, "printed.yaml", buf.String())); err != nil {
+		t.Fatalf("loadFile() of the printed configuration error = %v\n%s", err, buf.String())
+	}
+	// Unset lists come back empty rather than nil, so the loaded configuration is compared as printed
+	var reprinted bytes.Buffer
+	if err := loaded.Print(&reprinted); err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+	if reprinted.String() != buf.String() {
+		t.Errorf("loaded configuration differs from the printed one\nprinted:\n%s\nloaded:\n%s", buf.String(), reprinted.String())
+	}
+	if !reflect.DeepEqual(loaded.Upload.MaxTypeSizes, cfg.Upload.MaxTypeSizes) || loaded.Janitor.OutputTTL != cfg.Janitor.OutputTTL {
+		t.Errorf("loaded type sizes %v and output TTL %v, want %v and %v",
+			loaded.Upload.MaxTypeSizes, loaded.Janitor.OutputTTL, cfg.Upload.MaxTypeSizes, cfg.Janitor.OutputTTL)
+	}
+}
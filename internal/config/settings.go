@@ -0,0 +1,359 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting maps a config file key and an environment variable to a field of the configuration
+type setting struct {
+	key    string                      // Key in config files, sections separated by dots. Empty for environment-only settings.
+	env    string                      // Environment variable overriding the file
+	secret bool                        // Redacted when the configuration is printed
+	field  func(*Config) any           // Pointer to the field. *int64 fields hold byte sizes.
+	apply  func(*Config, string) error // Sets settings without a field of their own from the environment
+}
+
+// settings lists every configurable value, in the order they are printed.
+// Environment variables are applied in this order too.
+var settings = []setting{
+	{key: "server.port", env: "PORT", field: func(c *Config) any { return &c.Server.Port }},
+	{key: "server.host", env: "HOST", field: func(c *Config) any { return &c.Server.Host }},
+	{key: "server.debug", env: "DEBUG", field: func(c *Config) any { return &c.Server.Debug }},
+	{key: "server.shutdown_delay", env: "SHUTDOWN_DELAY", field: func(c *Config) any { return &c.Server.ShutdownDelay }},
+	{key: "server.shutdown_timeout", env: "SHUTDOWN_TIMEOUT", field: func(c *Config) any { return &c.Server.ShutdownTimeout }},
+
+	// Frontend origin, kept for existing deployments. It takes the place of the default frontend origin,
+	// the other origins stay allowed. CORS_ALLOWED_ORIGINS takes precedence.
+	{env: "FRONTEND_URL", apply: func(c *Config, value string) error {
+		origins := []string{strings.TrimSpace(value)}
+		for _, origin := range c.CORS.AllowedOrigins {
+			if origin != defaultFrontendURL && origin != origins[0] {
+				origins = append(origins, origin)
+			}
+		}
+		c.CORS.AllowedOrigins = origins
+		return nil
+	}},
+	{key: "cors.allowed_origins", env: "CORS_ALLOWED_ORIGINS", field: func(c *Config) any { return &c.CORS.AllowedOrigins }},
+	{key: "cors.allowed_methods", env: "CORS_ALLOWED_METHODS", field: func(c *Config) any { return &c.CORS.AllowedMethods }},
+	{key: "cors.allowed_headers", env: "CORS_ALLOWED_HEADERS", field: func(c *Config) any { return &c.CORS.AllowedHeaders }},
+	{key: "cors.exposed_headers", env: "CORS_EXPOSED_HEADERS", field: func(c *Config) any { return &c.CORS.ExposedHeaders }},
+	{key: "cors.allow_credentials", env: "CORS_ALLOW_CREDENTIALS", field: func(c *Config) any { return &c.CORS.AllowCredentials }},
+	{key: "cors.max_age", env: "CORS_MAX_AGE", field: func(c *Config) any { return &c.CORS.MaxAge }},
+
+	{key: "upload.max_file_size", env: "MAX_FILE_SIZE", field: func(c *Config) any { return &c.Upload.MaxFileSize }},
+	{key: "upload.max_type_sizes", env: "MAX_TYPE_SIZES", field: func(c *Config) any { return &c.Upload.MaxTypeSizes }},
+	{key: "upload.max_request_size", env: "MAX_REQUEST_SIZE", field: func(c *Config) any { return &c.Upload.MaxRequestSize }},
+	{key: "upload.max_files", env: "MAX_FILES", field: func(c *Config) any { return &c.Upload.MaxFiles }},
+	{key: "upload.max_batch_groups", env: "MAX_BATCH_GROUPS", field: func(c *Config) any { return &c.Upload.MaxBatchGroups }},
+	{key: "upload.max_archive_size", env: "MAX_ARCHIVE_SIZE", field: func(c *Config) any { return &c.Upload.MaxArchiveSize }},
+	{key: "upload.max_archive_entries", env: "MAX_ARCHIVE_ENTRIES", field: func(c *Config) any { return &c.Upload.MaxArchiveEntries }},
+	{key: "upload.max_archive_depth", env: "MAX_ARCHIVE_DEPTH", field: func(c *Config) any { return &c.Upload.MaxArchiveDepth }},
+	{key: "upload.max_image_width", env: "MAX_IMAGE_WIDTH", field: func(c *Config) any { return &c.Upload.MaxImageWidth }},
+	{key: "upload.max_image_height", env: "MAX_IMAGE_HEIGHT", field: func(c *Config) any { return &c.Upload.MaxImageHeight }},
+	{key: "upload.max_image_megapixels", env: "MAX_IMAGE_MEGAPIXELS", field: func(c *Config) any { return &c.Upload.MaxImageMegapixels }},
+	{key: "upload.allowed_types", env: "ALLOWED_TYPES", field: func(c *Config) any { return &c.Upload.AllowedTypes }},
+	{key: "upload.temp_dir", env: "TEMP_DIR", field: func(c *Config) any { return &c.Upload.TempDir }},
+	{key: "upload.upload_dir", env: "UPLOAD_DIR", field: func(c *Config) any { return &c.Upload.UploadDir }},
+
+	{key: "pdf.output_dir", env: "PDF_OUTPUT_DIR", field: func(c *Config) any { return &c.PDF.OutputDir }},
+	{key: "pdf.page_format", env: "PDF_PAGE_FORMAT", field: func(c *Config) any { return &c.PDF.PageFormat }},
+	{key: "pdf.orientation", env: "PDF_ORIENTATION", field: func(c *Config) any { return &c.PDF.Orientation }},
+	{key: "pdf.rasterizer", env: "PDF_RASTERIZER", field: func(c *Config) any { return &c.PDF.RasterizerPath }},
+	{key: "pdf.raster_dpi", env: "PDF_RASTER_DPI", field: func(c *Config) any { return &c.PDF.DefaultRasterDPI }},
+	{key: "pdf.max_raster_dpi", env: "PDF_MAX_RASTER_DPI", field: func(c *Config) any { return &c.PDF.MaxRasterDPI }},
+	{key: "pdf.conversion_timeout", env: "CONVERSION_TIMEOUT", field: func(c *Config) any { return &c.PDF.ConversionTimeout }},
+
+	{key: "storage.backend", env: "STORAGE_BACKEND", field: func(c *Config) any { return &c.Storage.Backend }},
+	{key: "storage.s3_endpoint", env: "S3_ENDPOINT", field: func(c *Config) any { return &c.Storage.S3Endpoint }},
+	{key: "storage.s3_region", env: "S3_REGION", field: func(c *Config) any { return &c.Storage.S3Region }},
+	{key: "storage.s3_bucket", env: "S3_BUCKET", field: func(c *Config) any { return &c.Storage.S3Bucket }},
+	{key: "storage.s3_prefix", env: "S3_PREFIX", field: func(c *Config) any { return &c.Storage.S3Prefix }},
+	{key: "storage.s3_access_key", env: "S3_ACCESS_KEY", secret: true, field: func(c *Config) any { return &c.Storage.S3AccessKey }},
+	{key: "storage.s3_secret_key", env: "S3_SECRET_KEY", secret: true, field: func(c *Config) any { return &c.Storage.S3SecretKey }},
+	{key: "storage.s3_timeout", env: "S3_TIMEOUT", field: func(c *Config) any { return &c.Storage.S3Timeout }},
+
+	{key: "janitor.output_ttl", env: "OUTPUT_TTL", field: func(c *Config) any { return &c.Janitor.OutputTTL }},
+	{key: "janitor.temp_max_age", env: "TEMP_MAX_AGE", field: func(c *Config) any { return &c.Janitor.TempMaxAge }},
+	{key: "janitor.interval", env: "JANITOR_INTERVAL", field: func(c *Config) any { return &c.Janitor.Interval }},
+
+	{key: "download.signing_secret", env: "DOWNLOAD_SIGNING_SECRET", secret: true, field: func(c *Config) any { return &c.Download.SigningSecret }},
+	{key: "download.link_ttl", env: "DOWNLOAD_LINK_TTL", field: func(c *Config) any { return &c.Download.LinkTTL }},
+
+	{key: "auth.keys_file", env: "API_KEYS_FILE", field: func(c *Config) any { return &c.Auth.KeysFile }},
+	{key: "auth.keys", env: "API_KEYS", secret: true, field: func(c *Config) any { return &c.Auth.Keys }},
+	{key: "auth.daily_conversions", env: "API_KEY_DAILY_CONVERSIONS", field: func(c *Config) any { return &c.Auth.DefaultDailyConversions }},
+	{key: "auth.daily_bytes", env: "API_KEY_DAILY_BYTES", field: func(c *Config) any { return &c.Auth.DefaultDailyBytes }},
+	{key: "auth.max_pages", env: "API_KEY_MAX_PAGES", field: func(c *Config) any { return &c.Auth.DefaultMaxPages }},
+
+	{key: "limits.rate_limit_per_minute", env: "RATE_LIMIT_PER_MINUTE", field: func(c *Config) any { return &c.Limits.RequestsPerMinute }},
+	{key: "limits.rate_limit_burst", env: "RATE_LIMIT_BURST", field: func(c *Config) any { return &c.Limits.Burst }},
+	{key: "limits.max_concurrent_conversions", env: "MAX_CONCURRENT_CONVERSIONS", field: func(c *Config) any { return &c.Limits.MaxConcurrentConversions }},
+	{key: "limits.queue_timeout", env: "CONVERSION_QUEUE_TIMEOUT", field: func(c *Config) any { return &c.Limits.QueueTimeout }},
+	{key: "limits.trusted_proxies", env: "TRUSTED_PROXIES", field: func(c *Config) any { return &c.Limits.TrustedProxies }},
+
+	{key: "metrics.enabled", env: "METRICS_ENABLED", field: func(c *Config) any { return &c.Metrics.Enabled }},
+
+	{key: "tracing.exporter", env: "OTEL_TRACES_EXPORTER", field: func(c *Config) any { return &c.Tracing.Exporter }},
+	// The standard base endpoint, spans go to its /v1/traces path unless the full URL is set as well
+	{env: "OTEL_EXPORTER_OTLP_ENDPOINT", apply: func(c *Config, value string) error {
+		c.Tracing.Endpoint = strings.TrimRight(value, "/") + "/v1/traces"
+		return nil
+	}},
+	{key: "tracing.endpoint", env: "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", field: func(c *Config) any { return &c.Tracing.Endpoint }},
+	{key: "tracing.headers", env: "OTEL_EXPORTER_OTLP_HEADERS", secret: true, field: func(c *Config) any { return &c.Tracing.Headers }},
+	{key: "tracing.service_name", env: "OTEL_SERVICE_NAME", field: func(c *Config) any { return &c.Tracing.ServiceName }},
+
+	{key: "health.min_free_disk", env: "HEALTH_MIN_FREE_DISK", field: func(c *Config) any { return &c.Health.MinFreeDisk }},
+	{key: "health.max_queued_conversions", env: "HEALTH_MAX_QUEUED_CONVERSIONS", field: func(c *Config) any { return &c.Health.MaxQueuedConversions }},
+	{key: "health.check_timeout", env: "HEALTH_CHECK_TIMEOUT", field: func(c *Config) any { return &c.Health.CheckTimeout }},
+
+	{key: "fetch.timeout", env: "FETCH_TIMEOUT", field: func(c *Config) any { return &c.Fetch.Timeout }},
+	{key: "fetch.max_redirects", env: "FETCH_MAX_REDIRECTS", field: func(c *Config) any { return &c.Fetch.MaxRedirects }},
+	{key: "fetch.allow_private_networks", env: "FETCH_ALLOW_PRIVATE_NETWORKS", field: func(c *Config) any { return &c.Fetch.AllowPrivateNetworks }},
+
+	{key: "app.name", env: "APP_NAME", field: func(c *Config) any { return &c.App.Name }},
+	{key: "app.version", env: "APP_VERSION", field: func(c *Config) any { return &c.App.Version }},
+	{key: "app.environment", env: "ENVIRONMENT", field: func(c *Config) any { return &c.App.Environment }},
+}
+
+// setString parses a value given as text, e.g. from an environment variable.
+// Lists are comma-separated, size maps are lists of name=size pairs.
+func (s setting) setString(cfg *Config, value string) error {
+	if s.apply != nil {
+		return s.apply(cfg, value)
+	}
+
+	switch field := s.field(cfg).(type) {
+	case *string:
+		*field = value
+	case *bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*field = parsed
+	case *int:
+		parsed, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*field = parsed
+	case *int64:
+		parsed, err := ParseSize(value)
+		if err != nil {
+			return err
+		}
+		*field = parsed
+	case *float64:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*field = parsed
+	case *time.Duration:
+		parsed, err := ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field = parsed
+	case *[]string:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field = list
+	case *map[string]int64:
+		sizes := map[string]int64{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			name, size, ok := strings.Cut(item, "=")
+			if !ok || strings.TrimSpace(name) == "" {
+				return fmt.Errorf("invalid entry %q, expected name=size such as image/gif=2MB", item)
+			}
+			parsed, err := ParseSize(size)
+			if err != nil {
+				return err
+			}
+			sizes[strings.TrimSpace(name)] = parsed
+		}
+		*field = sizes
+	default:
+		return fmt.Errorf("unsupported setting type %T", field)
+	}
+	return nil
+}
+
+// setValue sets a value decoded from a config file. Strings are parsed like environment
+// variables, so sizes and durations can be written as "10MB" and "2m".
+func (s setting) setValue(cfg *Config, value any) error {
+	if text, ok := value.(string); ok {
+		return s.setString(cfg, text)
+	}
+
+	switch field := s.field(cfg).(type) {
+	case *string:
+		// Ports and versions may be written without quotes
+		parsed, err := integerValue(value)
+		if err != nil {
+			return fmt.Errorf("expected a string, got %v", value)
+		}
+		*field = strconv.FormatInt(parsed, 10)
+	case *bool:
+		parsed, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected a boolean, got %v", value)
+		}
+		*field = parsed
+	case *int:
+		parsed, err := integerValue(value)
+		if err != nil {
+			return err
+		}
+		*field = int(parsed)
+	case *int64:
+		parsed, err := integerValue(value)
+		if err != nil {
+			return err
+		}
+		*field = parsed
+	case *float64:
+		switch number := value.(type) {
+		case float64:
+			*field = number
+		case int, int64:
+			parsed, _ := integerValue(number)
+			*field = float64(parsed)
+		default:
+			return fmt.Errorf("expected a number, got %v", value)
+		}
+	case *time.Duration:
+		return fmt.Errorf("expected a duration such as \"30s\" or \"2m\", got %v", value)
+	case *[]string:
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("expected a list, got %v", value)
+		}
+		list := make([]string, 0, len(items))
+		for _, item := range items {
+			text, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("expected a list of strings, got %v", item)
+			}
+			list = append(list, text)
+		}
+		*field = list
+	case *map[string]int64:
+		items, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("expected a map of sizes, got %v", value)
+		}
+		sizes := make(map[string]int64, len(items))
+		for name, item := range items {
+			var parsed int64
+			var err error
+			if text, ok := item.(string); ok {
+				parsed, err = ParseSize(text)
+			} else {
+				parsed, err = integerValue(item)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			sizes[name] = parsed
+		}
+		*field = sizes
+	default:
+		return fmt.Errorf("expected a string, got %v", value)
+	}
+	return nil
+}
+
+// integerValue returns a whole number decoded from a config file
+func integerValue(value any) (int64, error) {
+	switch number := value.(type) {
+	case int:
+		return int64(number), nil
+	case int64:
+		return number, nil
+	case uint64:
+		if number <= math.MaxInt64 {
+			return int64(number), nil
+		}
+	case float64:
+		if number == math.Trunc(number) && math.Abs(number) < math.MaxInt64 {
+			return int64(number), nil
+		}
+	}
+	return 0, fmt.Errorf("expected a whole number, got %v", value)
+}
+
+// sizeUnits are the suffixes accepted by ParseSize. They are powers of 1024, with or without the i.
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseSize parses a byte size such as "10MB", "1.5GiB" or "4096". Units are powers of 1024.
+func ParseSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil || number < 0 || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. \"10MB\" or a number of bytes", value)
+	}
+	size := number * float64(multiplier)
+	if size != math.Trunc(size) || size >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q, expected a whole number of bytes", value)
+	}
+	return int64(size), nil
+}
+
+// FormatSize formats a byte size with the largest unit that represents it exactly
+func FormatSize(size int64) string {
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if size != 0 && size%unit.multiplier == 0 {
+			return strconv.FormatInt(size/unit.multiplier, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+// ParseDuration parses a duration such as "90s", "2m" or "1h30m", and whole days such as "7d"
+func ParseDuration(value string) (time.Duration, error) {
+	text := strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(text, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, expected e.g. \"30s\", \"2m\" or \"1h\"", value)
+	}
+	return duration, nil
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "4096", want: 4096},
+		{value: "0", want: 0},
+		{value: "512B", want: 512},
+		{value: "10K", want: 10 << 10},
+		{value: "10KB", want: 10 << 10},
+		{value: "10kib", want: 10 << 10},
+		{value: "20MB", want: 20 << 20},
+		{value: " 20 mb ", want: 20 << 20},
+		{value: "1.5GiB", want: 3 << 29},
+		{value: "2T", want: 2 << 40},
+		{value: "0.5KB", want: 512},
+		{value: "", wantErr: true},
+		{value: "MB", wantErr: true},
+		{value: "ten MB", wantErr: true},
+		{value: "-1MB", wantErr: true},
+		{value: "1.5B", wantErr: true},
+		{value: "0.1KB", wantErr: true},
+		{value: "10PB", wantErr: true},
+		{value: "9000000TB", wantErr: true},
+		{value: "Inf", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSize(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseSize(%q) = %d, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "0"},
+		{1000, "1000"},
+		{1 << 10, "1KB"},
+		{1536, "1536"},
+		{500 << 20, "500MB"},
+		{3 << 29, "1536MB"},
+		{2 << 40, "2TB"},
+	}
+
+	for _, tt := range tests {
+		got := FormatSize(tt.size)
+		if got != tt.want {
+			t.Errorf("FormatSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+		if parsed, err := ParseSize(got); err != nil || parsed != tt.size {
+			t.Errorf("ParseSize(FormatSize(%d)) = %d, %v", tt.size, parsed, err)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "30s", want: 30 * time.Second},
+		{value: "2m", want: 2 * time.Minute},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: " 10m ", want: 10 * time.Minute},
+		{value: "0", want: 0},
+		{value: "7d", want: 7 * 24 * time.Hour},
+		{value: "0d", want: 0},
+		{value: "", wantErr: true},
+		{value: "30", wantErr: true},
+		{value: "1.5d", wantErr: true},
+		{value: "-1d", wantErr: true},
+		{value: "d", wantErr: true},
+		{value: "2 minutes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseDuration(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseDuration(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseDuration(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{30 * time.Second, "30s"},
+		{2 * time.Minute, "2m"},
+		{90 * time.Minute, "1h30m"},
+		{time.Hour, "1h"},
+		{24 * time.Hour, "1d"},
+		{36 * time.Hour, "36h"},
+		{1500 * time.Millisecond, "1.5s"},
+	}
+
+	for _, tt := range tests {
+		got := FormatDuration(tt.d)
+		if got != tt.want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+		if parsed, err := ParseDuration(got); err != nil || parsed != tt.d {
+			t.Errorf("ParseDuration(FormatDuration(%v)) = %v, %v", tt.d, parsed, err)
+		}
+	}
+}
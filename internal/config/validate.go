@@ -0,0 +1,161 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"img-to-pdf-converter/pkg/converter"
+)
+
+// validate checks the settings for values the service can't run with and returns all problems at once
+func (c *Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port <= 65535, "server.port: invalid port %q", c.Server.Port)
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay: must not be negative")
+	check(c.Server.ShutdownTimeout >= 0, "server.shutdown_timeout: must not be negative")
+
+	check(len(c.CORS.AllowedOrigins) > 0, "cors.allowed_origins: must not be empty, use \"*\" to allow any origin")
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(isValidOrigin(origin), "cors.allowed_origins: invalid origin %q, expected e.g. https://app.example.com or https://*.example.com", origin)
+	}
+	check(len(c.CORS.AllowedMethods) > 0, "cors.allowed_methods: must not be empty")
+	if c.CORS.AllowCredentials {
+		// Browsers refuse credentialed responses for wildcards, and reflecting anything would defeat the list
+		check(!contains(c.CORS.AllowedOrigins, "*"), "cors.allowed_origins: \"*\" can't be combined with cors.allow_credentials")
+		check(!contains(c.CORS.AllowedHeaders, "*"), "cors.allowed_headers: \"*\" can't be combined with cors.allow_credentials")
+	}
+	check(c.CORS.MaxAge >= 0, "cors.max_age: must not be negative")
+
+	check(c.Upload.MaxFileSize > 0, "upload.max_file_size: must be positive")
+	contentTypes := make([]string, 0, len(c.Upload.MaxTypeSizes))
+	for contentType := range c.Upload.MaxTypeSizes {
+		contentTypes = append(contentTypes, contentType)
+	}
+	sort.Strings(contentTypes)
+	for _, contentType := range contentTypes {
+		size := c.Upload.MaxTypeSizes[contentType]
+		check(size > 0, "upload.max_type_sizes: %s must be positive", contentType)
+		check(contains(c.Upload.AllowedTypes, contentType), "upload.max_type_sizes: %s is not in upload.allowed_types", contentType)
+	}
+	check(c.Upload.MaxRequestSize > 0, "upload.max_request_size: must be positive")
+	check(c.Upload.MaxFiles > 0, "upload.max_files: must be positive")
+	check(c.Upload.MaxBatchGroups > 0, "upload.max_batch_groups: must be positive")
+	check(c.Upload.MaxArchiveSize > 0, "upload.max_archive_size: must be positive")
+	check(c.Upload.MaxArchiveEntries > 0, "upload.max_archive_entries: must be positive")
+	check(c.Upload.MaxArchiveDepth >= 0, "upload.max_archive_depth: must not be negative")
+	check(c.Upload.MaxImageWidth > 0, "upload.max_image_width: must be positive")
+	check(c.Upload.MaxImageHeight > 0, "upload.max_image_height: must be positive")
+	check(c.Upload.MaxImageMegapixels > 0, "upload.max_image_megapixels: must be positive")
+	check(len(c.Upload.AllowedTypes) > 0, "upload.allowed_types: must not be empty")
+	check(c.Upload.TempDir != "", "upload.temp_dir: must not be empty")
+	check(c.Upload.UploadDir != "", "upload.upload_dir: must not be empty")
+
+	check(c.PDF.OutputDir != "", "pdf.output_dir: must not be empty")
+	check(converter.IsValidPageSize(c.PDF.PageFormat), "pdf.page_format: must be A3, A4, A5, Letter or Legal, got %q", c.PDF.PageFormat)
+	check(c.PDF.Orientation == "P" || c.PDF.Orientation == "L", "pdf.orientation: must be P or L, got %q", c.PDF.Orientation)
+	check(c.PDF.RasterizerPath != "", "pdf.rasterizer: must not be empty")
+	check(c.PDF.DefaultRasterDPI > 0, "pdf.raster_dpi: must be positive")
+	check(c.PDF.MaxRasterDPI >= c.PDF.DefaultRasterDPI, "pdf.max_raster_dpi: must be at least pdf.raster_dpi (%d)", c.PDF.DefaultRasterDPI)
+	// The janitor takes temp files older than temp_max_age for leftovers, only a timeout keeps running conversions younger
+	check(c.PDF.ConversionTimeout > 0, "pdf.conversion_timeout: must be positive")
+
+	switch c.Storage.Backend {
+	case "filesystem", "memory":
+	case "s3":
+		check(c.Storage.S3Bucket != "", "storage.s3_bucket: required for s3 storage")
+		check(c.Storage.S3AccessKey != "" && c.Storage.S3SecretKey != "", "storage.s3_access_key and storage.s3_secret_key: required for s3 storage")
+		check(isHTTPURL(c.Storage.S3Endpoint), "storage.s3_endpoint: invalid URL %q", c.Storage.S3Endpoint)
+		// Shared storage means several replicas, each must accept the links the others issue
+		check(c.Download.SigningSecret != "", "download.signing_secret: required for s3 storage, set the same secret on all replicas")
+		check(c.Storage.S3Timeout > 0, "storage.s3_timeout: must be positive")
+	default:
+		check(false, "storage.backend: must be filesystem, memory or s3, got %q", c.Storage.Backend)
+	}
+
+	check(c.Janitor.OutputTTL >= 0, "janitor.output_ttl: must not be negative")
+	check(c.Janitor.TempMaxAge > 0, "janitor.temp_max_age: must be positive")
+	// The janitor would otherwise remove the temp files of conversions that are still running
+	check(c.Janitor.TempMaxAge > c.PDF.ConversionTimeout, "janitor.temp_max_age: must be longer than pdf.conversion_timeout (%s)", c.PDF.ConversionTimeout)
+	check(c.Janitor.Interval > 0, "janitor.interval: must be positive")
+	check(c.Download.LinkTTL > 0, "download.link_ttl: must be positive")
+
+	for _, entry := range c.Auth.Keys {
+		name, key, found := strings.Cut(entry, ":")
+		check(found && name != "" && key != "", "auth.keys: expected name:key pairs")
+	}
+	check(c.Auth.DefaultDailyConversions >= 0, "auth.daily_conversions: must not be negative")
+	check(c.Auth.DefaultDailyBytes >= 0, "auth.daily_bytes: must not be negative")
+	check(c.Auth.DefaultMaxPages >= 0, "auth.max_pages: must not be negative")
+
+	check(c.Limits.RequestsPerMinute >= 0, "limits.rate_limit_per_minute: must not be negative")
+	check(c.Limits.RequestsPerMinute == 0 || c.Limits.Burst > 0, "limits.rate_limit_burst: must be positive when rate limiting is enabled")
+	check(c.Limits.MaxConcurrentConversions >= 0, "limits.max_concurrent_conversions: must not be negative")
+	check(c.Limits.QueueTimeout >= 0, "limits.queue_timeout: must not be negative")
+	for _, cidr := range c.Limits.TrustedProxies {
+		_, _, err := net.ParseCIDR(cidr)
+		check(err == nil, "limits.trusted_proxies: invalid CIDR %q", cidr)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none":
+	case "otlp":
+		check(isHTTPURL(c.Tracing.Endpoint), "tracing.endpoint: invalid URL %q", c.Tracing.Endpoint)
+		for _, header := range c.Tracing.Headers {
+			key, _, found := strings.Cut(header, "=")
+			check(found && strings.TrimSpace(key) != "", "tracing.headers: expected key=value pairs")
+		}
+	default:
+		check(false, "tracing.exporter: must be none or otlp, got %q", c.Tracing.Exporter)
+	}
+
+	check(c.Health.MinFreeDisk >= 0, "health.min_free_disk: must not be negative")
+	check(c.Health.MaxQueuedConversions >= 0, "health.max_queued_conversions: must not be negative")
+	check(c.Health.CheckTimeout >= 0, "health.check_timeout: must not be negative")
+
+	check(c.Fetch.Timeout > 0, "fetch.timeout: must be positive")
+	check(c.Fetch.MaxRedirects >= 0, "fetch.max_redirects: must not be negative")
+
+	return errors.Join(errs...)
+}
+
+// isValidOrigin reports whether origin is "*" or a scheme and host, optionally with a port and
+// a single wildcard such as https://*.example.com
+func isValidOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	if strings.Count(origin, "*") > 1 {
+		return false
+	}
+	parsed, err := url.Parse(strings.Replace(origin, "*", "wildcard", 1))
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" &&
+		parsed.Path == "" && parsed.RawQuery == "" && parsed.User == nil
+}
+
+// contains reports whether list holds value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTTPURL reports whether value is an absolute http or https URL
+func isHTTPURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTempMaxAge(t *testing.T) {
+	tests := []struct {
+		name              string
+		tempMaxAge        time.Duration
+		conversionTimeout time.Duration
+		wantErr           string
+	}{
+		{"longer than the timeout", time.Hour, 2 * time.Minute, ""},
+		{"no conversion timeout", time.Hour, 0, "pdf.conversion_timeout: must be positive"},
+		{"equal to the timeout", 2 * time.Minute, 2 * time.Minute, "janitor.temp_max_age: must be longer than pdf.conversion_timeout"},
+		{"shorter than the timeout", time.Minute, 2 * time.Minute, "janitor.temp_max_age: must be longer than pdf.conversion_timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaults()
+			cfg.Janitor.TempMaxAge = tt.tempMaxAge
+			cfg.PDF.ConversionTimeout = tt.conversionTimeout
+
+			err := cfg.validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("validate() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestValidatePageFormat(t *testing.T) {
+	for _, format := range []string{"A4", "a4", "Letter", "LEGAL", "A3", "A5"} {
+		cfg := defaults()
+		cfg.PDF.PageFormat = format
+		if err := cfg.validate(); err != nil {
+			t.Errorf("validate() with page format %q error = %v", format, err)
+		}
+	}
+
+	cfg := defaults()
+	cfg.PDF.PageFormat = "B5"
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "pdf.page_format: must be A3, A4, A5, Letter or Legal") {
+		t.Errorf("validate() with page format B5 error = %v", err)
+	}
+}
+
+func TestValidateSigningSecretForSharedStorage(t *testing.T) {
+	cfg := defaults()
+	cfg.Storage.Backend = "s3"
+	cfg.Storage.S3Endpoint = "http://minio:9000"
+	cfg.Storage.S3Bucket = "outputs"
+	cfg.Storage.S3AccessKey = "access"
+	cfg.Storage.S3SecretKey = "secret"
+
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "download.signing_secret: required for s3 storage") {
+		t.Errorf("validate() without signing secret error = %v", err)
+	}
+
+	cfg.Download.SigningSecret = "shared"
+	if err := cfg.validate(); err != nil {
+		t.Errorf("validate() error = %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"img-to-pdf-converter/internal/services"
+)
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// APIKeyAuth returns middleware that requires a valid API key in the X-API-Key header or
+// as a bearer token. A conversion and the declared request bytes are reserved against the daily
+// quotas of the key before the request runs, and requests over them are refused. Failed requests
+// get their reservation back, successful ones are charged the request bytes actually read.
+func (h *Handler) APIKeyAuth(keys *services.APIKeyService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, err := keys.Authenticate(apiKeyFromRequest(r))
+			switch {
+			case err == nil:
+			case errors.Is(err, services.ErrAPIKeyDisabled):
+				h.sendErrorResponse(w, "API key is disabled", http.StatusForbidden)
+				return
+			case errors.Is(err, services.ErrAPIKeyMissing):
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				h.sendErrorResponse(w, "API key required", http.StatusUnauthorized)
+				return
+			default:
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				h.sendErrorResponse(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+
+			// A declared body size is reserved up front, so large uploads are refused before they are read.
+			// Bodies of unknown size reserve a single byte, which refuses keys that used up their bytes.
+			requestBytes := r.ContentLength
+			if requestBytes <= 0 {
+				requestBytes = 1
+			}
+			reservation, err := keys.Reserve(r.Context(), key, requestBytes)
+			if err != nil {
+				if !errors.Is(err, services.ErrQuotaExceeded) {
+					slog.ErrorContext(r.Context(), "Failed to check quota", "api_key", key.Name, "error", err)
+					h.sendErrorResponse(w, "Failed to check quota", http.StatusInternalServerError)
+					return
+				}
+				h.sendQuotaExceeded(w, r, key)
+				return
+			}
+
+			body := &countingReader{ReadCloser: r.Body}
+			r.Body = body
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			// Only conversions that produced a result count against the quota. A panic, such as
+			// http.ErrAbortHandler from a stream cut off after its status was sent, is a failure too.
+			defer func() {
+				recovered := recover()
+				if status := ww.Status(); recovered != nil || status < http.StatusOK || status >= http.StatusBadRequest {
+					if err := reservation.Refund(context.WithoutCancel(r.Context())); err != nil {
+						slog.ErrorContext(r.Context(), "Failed to refund usage", "api_key", key.Name, "error", err)
+					}
+				} else if err := reservation.Settle(context.WithoutCancel(r.Context()), body.n); err != nil {
+					slog.ErrorContext(r.Context(), "Failed to record usage", "api_key", key.Name, "error", err)
+				}
+				if recovered != nil {
+					panic(recovered)
+				}
+			}()
+
+			ctx := services.WithUsageReservation(services.WithAPIKey(r.Context(), key), reservation)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+		})
+	}
+}
+
+// reserveDocuments reserves a conversion for every output document of a request beyond the first,
+// which the authentication middleware already reserved. It sends the error response and returns
+// false when the key doesn't have enough conversions left.
+func (h *Handler) reserveDocuments(w http.ResponseWriter, r *http.Request, documents int) bool {
+	reservation := services.UsageReservationFromContext(r.Context())
+	if reservation == nil || documents <= 1 {
+		return true
+	}
+	err := reservation.Add(r.Context(), services.Usage{Conversions: documents - 1})
+	if err == nil {
+		return true
+	}
+	key := services.APIKeyFromContext(r.Context())
+	if !errors.Is(err, services.ErrQuotaExceeded) {
+		slog.ErrorContext(r.Context(), "Failed to check quota", "api_key", key.Name, "error", err)
+		h.sendErrorResponse(w, "Failed to check quota", http.StatusInternalServerError)
+		return false
+	}
+	h.sendQuotaExceeded(w, r, key)
+	return false
+}
+
+// sendQuotaExceeded refuses a request over the daily quotas of its key until they reset
+func (h *Handler) sendQuotaExceeded(w http.ResponseWriter, r *http.Request, key *services.APIKey) {
+	slog.InfoContext(r.Context(), "API key is over its daily quota", "api_key", key.Name)
+	w.Header().Set("Retry-After", strconv.Itoa(secondsUntilNextDay(time.Now())))
+	h.sendErrorResponse(w, "Daily quota exceeded", http.StatusTooManyRequests)
+}
+
+// apiKeyFromRequest returns the API key sent in the X-API-Key header or as a bearer token
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	auth := r.Header.Get("Authorization")
+	if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(auth[len("Bearer "):])
+	}
+	return ""
+}
+
+// secondsUntilNextDay returns the seconds until the daily quotas reset at midnight UTC
+func secondsUntilNextDay(now time.Time) int {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return int(next.Sub(now).Seconds()) + 1
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"img-to-pdf-converter/internal/config"
+	"img-to-pdf-converter/internal/services"
+)
+
+func TestAPIKeyAuthUsage(t *testing.T) {
+	cfg := &config.Config{Auth: config.AuthConfig{Keys: []string{"acme:secret"}, DefaultDailyConversions: 4}}
+	usage := services.NewMemoryUsageStore()
+	keys, err := services.NewAPIKeyService(cfg, usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{config: cfg}
+
+	// The test handler reads the body, reserves the requested documents and answers with the requested status
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		documents := 1
+		if r.Form.Get("documents") == "3" {
+			documents = 3
+		}
+		if !h.reserveDocuments(w, r, documents) {
+			return
+		}
+		if r.Form.Get("fail") == "true" {
+			h.sendErrorResponse(w, "conversion failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if r.Form.Get("abort") == "true" {
+			// A stream cut off after its status was sent
+			panic(http.ErrAbortHandler)
+		}
+	})
+	handler := h.APIKeyAuth(keys)(next)
+
+	send := func(form string) (status int) {
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-API-Key", "secret")
+		rec := httptest.NewRecorder()
+		defer func() {
+			if recovered := recover(); recovered != nil && recovered != http.ErrAbortHandler {
+				panic(recovered)
+			}
+			status = rec.Code
+		}()
+		handler.ServeHTTP(rec, req)
+		return
+	}
+	// Failed requests get their reservation back, a batch counts every document
+	steps := []struct {
+		form            string
+		wantStatus      int
+		wantConversions int
+		wantBytes       int64
+	}{
+		{"fail=true", http.StatusInternalServerError, 0, 0},
+		{"abort=true", http.StatusOK, 0, 0},
+		{"documents=1", http.StatusOK, 1, 11},
+		{"documents=3", http.StatusOK, 4, 22},
+		{"documents=1", http.StatusTooManyRequests, 4, 22},
+	}
+	for i, step := range steps {
+		if got := send(step.form); got != step.wantStatus {
+			t.Fatalf("request %d (%s) status = %d, want %d", i+1, step.form, got, step.wantStatus)
+		}
+		total, _ := usage.Get(context.Background(), "acme", time.Now().UTC().Format("2006-01-02"))
+		if total.Conversions != step.wantConversions || total.Bytes != step.wantBytes {
+			t.Errorf("after request %d (%s) usage = %+v, want %d conversions and %d bytes",
+				i+1, step.form, total, step.wantConversions, step.wantBytes)
+		}
+	}
+}
@@ -1,9 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"img-to-pdf-converter/internal/config"
 	"img-to-pdf-converter/internal/models"
@@ -15,30 +22,162 @@ type Handler struct {
 	config      *config.Config
 	pdfService  *services.PDFService
 	fileService *services.FileService
+	storage     services.Storage
+	signer      *services.DownloadSigner
+	health      *services.HealthChecker
+	limiter     *services.ConversionLimiter // Conversion slots, unlimited when nil
+	draining    atomic.Bool                 // Set on shutdown, the instance no longer reports ready
 }
 
 // NewHandler creates a new handler instance
-func NewHandler(cfg *config.Config, pdfService *services.PDFService, fileService *services.FileService) *Handler {
+func NewHandler(cfg *config.Config, pdfService *services.PDFService, fileService *services.FileService, storage services.Storage, signer *services.DownloadSigner, health *services.HealthChecker, limiter *services.ConversionLimiter) *Handler {
 	return &Handler{
 		config:      cfg,
 		pdfService:  pdfService,
 		fileService: fileService,
+		storage:     storage,
+		signer:      signer,
+		health:      health,
+		limiter:     limiter,
 	}
 }
 
+// StartDraining marks the instance as shutting down, so readiness checks fail and load balancers
+// stop sending it new requests while the running ones finish
+func (h *Handler) StartDraining() {
+	h.draining.Store(true)
+}
+
 // sendErrorResponse sends an error response in JSON format
 func (h *Handler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
-	response := models.ErrorResponse{
+	h.writeErrorResponse(w, models.ErrorResponse{
 		Success: false,
 		Error:   message,
 		Code:    statusCode,
+	})
+}
+
+// sendValidationError sends a 400 for a rejected upload, with the reason of the rejection as error code
+func (h *Handler) sendValidationError(w http.ResponseWriter, message string, err error) {
+	response := models.ErrorResponse{
+		Success: false,
+		Error:   message,
+		Code:    http.StatusBadRequest,
+	}
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		response.ErrorCode = validationErr.Reason
 	}
+	h.writeErrorResponse(w, response)
+}
 
+// writeErrorResponse writes an error response with its code as HTTP status
+func (h *Handler) writeErrorResponse(w http.ResponseWriter, response models.ErrorResponse) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+	w.WriteHeader(response.Code)
 	json.NewEncoder(w).Encode(response)
 }
 
+// multipartOverhead is the room left for part headers and form fields on top of the file data of an upload
+const multipartOverhead = 1 << 20
+
+// parseUploadForm parses a multipart upload, reading at most the maximum request size.
+// When the form can't be read the error response is sent and the error returned.
+func (h *Handler) parseUploadForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.Upload.MaxRequestSize+multipartOverhead)
+
+	err := r.ParseMultipartForm(h.config.Upload.MaxFileSize)
+	if err == nil {
+		return nil
+	}
+
+	slog.InfoContext(r.Context(), "Failed to parse multipart form", "error", err)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.sendErrorResponse(w, fmt.Sprintf("Upload is too large (max: %d bytes)", h.config.Upload.MaxRequestSize), http.StatusRequestEntityTooLarge)
+		return err
+	}
+	h.sendErrorResponse(w, "Failed to parse form data", http.StatusBadRequest)
+	return err
+}
+
+// sendConversionError logs and reports a failed conversion. A passed conversion deadline is a 504,
+// while a cancelled request has no client left to answer unless a shutdown cancelled it.
+// Outputs over the page limit of the API key are refused with a 403, sources over the limits with a 400.
+func (h *Handler) sendConversionError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	var validationErr *services.ValidationError
+	switch {
+	case errors.Is(err, services.ErrConversionTimeout):
+		slog.WarnContext(r.Context(), "Conversion timed out", "timeout", h.config.PDF.ConversionTimeout)
+		h.sendErrorResponse(w, "Conversion timed out", http.StatusGatewayTimeout)
+	case errors.Is(err, context.Canceled):
+		if h.draining.Load() {
+			// Cancelled because the server stopped waiting for it, the client is still there
+			slog.WarnContext(r.Context(), "Conversion cancelled by shutdown")
+			w.Header().Set("Connection", "close")
+			h.sendErrorResponse(w, "Server is shutting down, please retry", http.StatusServiceUnavailable)
+			return
+		}
+		slog.InfoContext(r.Context(), "Conversion cancelled, client disconnected")
+	case errors.Is(err, services.ErrPageLimitExceeded):
+		slog.InfoContext(r.Context(), "Page limit of the API key exceeded")
+		h.sendErrorResponse(w, "Page limit of the API key exceeded", http.StatusForbidden)
+	case errors.As(err, &validationErr):
+		slog.InfoContext(r.Context(), "Conversion rejected", "reason", validationErr.Reason, "error", err)
+		h.sendValidationError(w, err.Error(), err)
+	default:
+		slog.ErrorContext(r.Context(), message, "error", err)
+		h.sendErrorResponse(w, message, http.StatusInternalServerError)
+	}
+}
+
+// outputExpiresAt returns when the janitor deletes outputs generated now, or nil if they are kept
+func (h *Handler) outputExpiresAt() *time.Time {
+	if h.config.Janitor.OutputTTL <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(h.config.Janitor.OutputTTL).UTC().Truncate(time.Second)
+	return &expiresAt
+}
+
+// downloadURL returns the signed download URL of a generated file.
+// With once=true in the request the file is deleted after its first download.
+func (h *Handler) downloadURL(r *http.Request, name string) string {
+	once := getFirstNonEmpty(r.URL.Query().Get("once"), r.FormValue("once")) == "true"
+	return h.signer.SignedURL(name, once)
+}
+
+// parseConversionOptions reads the conversion options from query parameters or form data.
+// With a suffix such as ".invoices" the suffixed keys take precedence over the plain ones.
+func (h *Handler) parseConversionOptions(r *http.Request, suffix string) (services.ConversionOptions, error) {
+	value := func(key string) string {
+		return getFirstNonEmpty(r.URL.Query().Get(key+suffix), r.FormValue(key+suffix), r.URL.Query().Get(key), r.FormValue(key))
+	}
+
+	return h.normalizeConversionOptions(services.ConversionOptions{
+		Fit:          value("fit") == "true",
+		Position:     value("position"),
+		Orientation:  value("orientation"),
+		OutputFormat: value("outputFormat"),
+	})
+}
+
+// normalizeConversionOptions applies the defaults for empty options and validates the output format
+func (h *Handler) normalizeConversionOptions(options services.ConversionOptions) (services.ConversionOptions, error) {
+	options.Position = getFirstNonEmpty(options.Position, "center")
+	options.Orientation = getFirstNonEmpty(options.Orientation, h.config.PDF.Orientation)
+
+	options.OutputFormat = strings.ToLower(getFirstNonEmpty(options.OutputFormat, services.OutputFormatPDF))
+	if options.OutputFormat == "tif" {
+		options.OutputFormat = services.OutputFormatTIFF
+	}
+	if !services.IsValidOutputFormat(options.OutputFormat) {
+		return services.ConversionOptions{}, fmt.Errorf("unsupported output format: %s", options.OutputFormat)
+	}
+
+	return options, nil
+}
+
 // Helper function to get map keys for logging
 func getStringMapKeys(m map[string][]string) []string {
 	keys := make([]string, 0, len(m))
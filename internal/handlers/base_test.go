@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"img-to-pdf-converter/internal/config"
+	"img-to-pdf-converter/internal/services"
+)
+
+func TestSendConversionError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		draining  bool
+		want      int
+		wantEmpty bool
+	}{
+		{name: "timeout", err: services.ErrConversionTimeout, want: http.StatusGatewayTimeout},
+		{name: "wrapped timeout", err: fmt.Errorf("failed to create ZIP archive: %w", services.ErrConversionTimeout), want: http.StatusGatewayTimeout},
+		{name: "wrapped page limit", err: fmt.Errorf("group a: %w", services.ErrPageLimitExceeded), want: http.StatusForbidden},
+		{name: "wrapped cancel", err: fmt.Errorf("group a: %w", context.Canceled), want: http.StatusOK, wantEmpty: true},
+		{name: "wrapped cancel on shutdown", err: fmt.Errorf("failed to store: %w", context.Canceled), draining: true, want: http.StatusServiceUnavailable},
+		{name: "other error", err: errors.New("disk full"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{config: &config.Config{}}
+			h.draining.Store(tt.draining)
+
+			rec := httptest.NewRecorder()
+			h.sendConversionError(rec, httptest.NewRequest(http.MethodPost, "/upload", nil), tt.err, "Failed")
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.wantEmpty && rec.Body.Len() != 0 {
+				t.Errorf("body = %q, want nothing written for a disconnected client", rec.Body.String())
+			}
+		})
+	}
+}
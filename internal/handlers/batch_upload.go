@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"img-to-pdf-converter/internal/models"
+	"img-to-pdf-converter/internal/services"
+)
+
+// groupNamePattern restricts group names to characters that are safe in filenames
+var groupNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// BatchUploadHandler handles uploads that are split into several independent documents.
+// Groups are either separate file fields ("files.<group>") or a "group" value per file in "files".
+// Options can be set per group with the same suffix, e.g. "orientation.<group>".
+func (h *Handler) BatchUploadHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "Batch upload request received")
+
+	if r.Method != http.MethodPost {
+		h.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form
+	if err := h.parseUploadForm(w, r); err != nil {
+		return
+	}
+
+	names, groupFiles, err := collectBatchGroups(r.MultipartForm)
+	if err != nil {
+		h.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(names) == 0 {
+		h.sendErrorResponse(w, "No files uploaded", http.StatusBadRequest)
+		return
+	}
+	if len(names) > h.config.Upload.MaxBatchGroups {
+		h.sendErrorResponse(w, "Too many groups", http.StatusBadRequest)
+		return
+	}
+
+	var groups []services.BatchGroup
+	for _, name := range names {
+		options, err := h.parseConversionOptions(r, "."+name)
+		if err != nil {
+			h.sendErrorResponse(w, "Group "+name+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Validate files
+		files, err := h.fileService.ValidateFiles(r.Context(), services.NewMultipartInputs(groupFiles[name]))
+		if err != nil {
+			slog.InfoContext(r.Context(), "File validation failed", "group", name, "error", err)
+			h.sendValidationError(w, "Group "+name+": "+err.Error(), err)
+			return
+		}
+
+		slog.DebugContext(r.Context(), "Batch group", "group", name, "files", len(files),
+			"fit", options.Fit, "position", options.Position, "orientation", options.Orientation, "output_format", options.OutputFormat)
+		groups = append(groups, services.BatchGroup{Name: name, Files: files, Options: options})
+	}
+
+	// Every document counts as a conversion against the quota of the API key
+	if !h.reserveDocuments(w, r, len(groups)) {
+		return
+	}
+
+	bundle := getFirstNonEmpty(r.URL.Query().Get("bundle"), r.FormValue("bundle")) == "zip"
+
+	release, ok := h.acquireConversionSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	results, zipName, err := h.pdfService.ConvertBatch(r.Context(), groups, bundle)
+	if err != nil {
+		h.sendConversionError(w, r, err, "Failed to convert batch")
+		return
+	}
+
+	// Return success response
+	response := models.BatchUploadResponse{
+		Success:   true,
+		ExpiresAt: h.outputExpiresAt(),
+		Message:   "Batch converted successfully",
+	}
+	for i, result := range results {
+		response.Documents = append(response.Documents, models.BatchDocument{
+			Group:       result.Name,
+			PDFFile:     result.OutputName,
+			Format:      groups[i].Options.OutputFormat,
+			DownloadURL: h.downloadURL(r, result.OutputName),
+		})
+	}
+	if zipName != "" {
+		response.ZipFile = zipName
+		response.ZipURL = h.downloadURL(r, zipName)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+
+	slog.InfoContext(r.Context(), "Batch upload completed", "documents", len(results))
+}
+
+// collectBatchGroups splits the uploaded files into named groups and returns the group names in order.
+// Field groups are sorted by name and come before groups assigned with the "group" field.
+func collectBatchGroups(form *multipart.Form) ([]string, map[string][]*multipart.FileHeader, error) {
+	groupFiles := make(map[string][]*multipart.FileHeader)
+	var names []string
+
+	// One multipart field per group: files.<group> or images.<group>
+	for key, files := range form.File {
+		prefix, name, ok := strings.Cut(key, ".")
+		if !ok || (prefix != "files" && prefix != "images") {
+			continue
+		}
+		if !groupNamePattern.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid group name: %s", name)
+		}
+		if _, exists := groupFiles[name]; !exists {
+			names = append(names, name)
+		}
+		groupFiles[name] = append(groupFiles[name], files...)
+	}
+	sort.Strings(names)
+
+	// A group value per file in the plain files field
+	files := form.File["images"]
+	if len(files) == 0 {
+		files = form.File["files"]
+	}
+	groupValues := form.Value["group"]
+	if len(files) > 0 && len(groupValues) != len(files) {
+		return nil, nil, fmt.Errorf("every file needs a group value")
+	}
+	for i, file := range files {
+		name := groupValues[i]
+		if !groupNamePattern.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid group name: %s", name)
+		}
+		if _, exists := groupFiles[name]; !exists {
+			names = append(names, name)
+		}
+		groupFiles[name] = append(groupFiles[name], file)
+	}
+
+	return names, groupFiles, nil
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"img-to-pdf-converter/internal/models"
+	"img-to-pdf-converter/internal/services"
+	"img-to-pdf-converter/internal/utils"
+)
+
+// jsonImage is a base64 encoded image in a JSON conversion request
+type jsonImage struct {
+	Name string `json:"name"`
+	Data string `json:"data"` // Base64, optionally as a data URL
+	Mime string `json:"mime"`
+}
+
+// jsonConvertRequest is the JSON body of a conversion request
+type jsonConvertRequest struct {
+	Images  []jsonImage                `json:"images"`
+	Options services.ConversionOptions `json:"options"`
+}
+
+// ConvertJSONHandler converts base64 encoded images sent as JSON, for clients that can't send multipart forms
+func (h *Handler) ConvertJSONHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "Convert JSON request received")
+
+	if r.Method != http.MethodPost {
+		h.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Base64 adds a third to the size of every file, leave room for names and options on top
+	maxBodySize := h.config.Upload.MaxRequestSize/3*4 + maxJSONRequestSize
+
+	var request jsonConvertRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&request); err != nil {
+		slog.InfoContext(r.Context(), "Invalid JSON body", "error", err)
+		h.sendErrorResponse(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	options, err := h.normalizeConversionOptions(request.Options)
+	if err != nil {
+		h.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "Conversion options", "fit", options.Fit, "position", options.Position, "orientation", options.Orientation, "output_format", options.OutputFormat)
+
+	if len(request.Images) == 0 {
+		h.sendErrorResponse(w, "No images provided", http.StatusBadRequest)
+		return
+	}
+	if len(request.Images) > h.config.Upload.MaxFiles {
+		h.sendErrorResponse(w, fmt.Sprintf("too many files: %d (max: %d)", len(request.Images), h.config.Upload.MaxFiles), http.StatusBadRequest)
+		return
+	}
+
+	inputs := make([]services.ImageInput, 0, len(request.Images))
+	for i, image := range request.Images {
+		input, err := h.decodeJSONImage(image, i)
+		if err != nil {
+			h.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		inputs = append(inputs, input)
+	}
+	// The decoded copies are all that is needed from here on
+	request.Images = nil
+
+	// Validate files
+	inputs, err = h.fileService.ValidateFiles(r.Context(), inputs)
+	if err != nil {
+		slog.InfoContext(r.Context(), "File validation failed", "error", err)
+		h.sendValidationError(w, err.Error(), err)
+		return
+	}
+
+	release, ok := h.acquireConversionSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Convert images with options
+	outputName, err := h.pdfService.ConvertImagesToPDFWithOptions(r.Context(), inputs, options)
+	if err != nil {
+		h.sendConversionError(w, r, err, "Failed to convert images")
+		return
+	}
+
+	// Return success response
+	response := models.UploadResponse{
+		Success:     true,
+		PDFFile:     outputName,
+		Format:      options.OutputFormat,
+		DownloadURL: h.downloadURL(r, outputName),
+		ExpiresAt:   h.outputExpiresAt(),
+		Message:     "Images converted to " + strings.ToUpper(options.OutputFormat) + " successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+
+	slog.InfoContext(r.Context(), "JSON conversion completed", "output", outputName)
+}
+
+// decodeJSONImage decodes the base64 data of an image into a conversion input.
+// The MIME type comes from the mime field, then the data URL prefix, and is sniffed as a last resort.
+func (h *Handler) decodeJSONImage(image jsonImage, index int) (services.ImageInput, error) {
+	name := utils.SanitizeFilename(image.Name)
+	if name == "" || name == "." || name == "/" {
+		name = fmt.Sprintf("image_%d", index+1)
+	}
+
+	encoded, mimeType := image.Data, image.Mime
+	if strings.HasPrefix(encoded, "data:") {
+		header, payload, ok := strings.Cut(encoded, ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return nil, fmt.Errorf("image %s has an invalid data URL", name)
+		}
+		encoded = payload
+		mimeType = getFirstNonEmpty(mimeType, strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64"))
+	}
+
+	// Reject oversized images before allocating memory for them, the limit of their type is checked on validation
+	if maxSize := h.config.Upload.LargestFileSize(); int64(base64.StdEncoding.DecodedLen(len(encoded))) > maxSize+2 {
+		return nil, fmt.Errorf("file %s is too large (max: %d bytes)", name, maxSize)
+	}
+
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("image %s is not valid base64: %v", name, err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("image %s is empty", name)
+	}
+
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+
+	return services.NewMemoryInput(name, mimeType, data), nil
+}
+
+// decodeBase64 accepts standard and URL-safe base64, with or without padding
+func decodeBase64(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	encodings := []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding}
+
+	var err error
+	for _, encoding := range encodings {
+		var data []byte
+		if data, err = encoding.DecodeString(encoded); err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
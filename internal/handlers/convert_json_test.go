@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"img-to-pdf-converter/internal/models"
+	"img-to-pdf-converter/internal/services"
+)
+
+func TestDecodeBase64(t *testing.T) {
+	data := []byte{0xfb, 0xff, 0xfe, 'a'}
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{name: "standard", encoded: base64.StdEncoding.EncodeToString(data)},
+		{name: "standard without padding", encoded: base64.RawStdEncoding.EncodeToString(data)},
+		{name: "URL-safe", encoded: base64.URLEncoding.EncodeToString(data)},
+		{name: "URL-safe without padding", encoded: base64.RawURLEncoding.EncodeToString(data)},
+		{name: "surrounding whitespace", encoded: "\n " + base64.StdEncoding.EncodeToString(data) + " \n"},
+		{name: "invalid characters", encoded: "+/8*YQ==", wantErr: true},
+		{name: "mixed alphabets", encoded: "+_-/YQ==", wantErr: true},
+		{name: "dangling character", encoded: "+/8fY", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeBase64(tt.encoded)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeBase64(%q) = %v, want an error", tt.encoded, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeBase64(%q) error = %v", tt.encoded, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("decodeBase64(%q) = %v, want %v", tt.encoded, got, data)
+			}
+		})
+	}
+}
+
+func TestConvertJSONRejectsInvalidImages(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString(pngHeader(10, 10))
+
+	tests := []struct {
+		name        string
+		image       jsonImage
+		maxFileSize int64
+		wantMessage string
+		wantCode    string
+	}{
+		{
+			name:        "malformed base64",
+			image:       jsonImage{Name: "page.png", Data: "iVBORw0K*not base64*", Mime: "image/png"},
+			wantMessage: "image page.png is not valid base64",
+		},
+		{
+			name:        "data URL without base64",
+			image:       jsonImage{Name: "page.png", Data: "data:image/png," + png},
+			wantMessage: "image page.png has an invalid data URL",
+		},
+		{
+			name:        "data URL without payload",
+			image:       jsonImage{Name: "page.png", Data: "data:image/png;base64"},
+			wantMessage: "image page.png has an invalid data URL",
+		},
+		{
+			name:        "empty image",
+			image:       jsonImage{Name: "page.png", Data: "", Mime: "image/png"},
+			wantMessage: "image page.png is empty",
+		},
+		{
+			name:        "wrong media type in data URL",
+			image:       jsonImage{Name: "page.png", Data: "data:text/html;base64," + png},
+			wantMessage: "file page.png has unsupported type: text/html",
+			wantCode:    "unsupported_type",
+		},
+		{
+			name:        "wrong media type in mime field",
+			image:       jsonImage{Name: "page.png", Data: png, Mime: "image/bmp"},
+			wantMessage: "file page.png has unsupported type: image/bmp",
+			wantCode:    "unsupported_type",
+		},
+		{
+			// Rejected from the encoded length, before the payload is decoded
+			name:        "oversize payload",
+			image:       jsonImage{Name: "page.png", Data: strings.Repeat("A", 4096), Mime: "image/png"},
+			maxFileSize: 1024,
+			wantMessage: "file page.png is too large (max: 1024 bytes)",
+		},
+		{
+			name:        "oversize data URL",
+			image:       jsonImage{Name: "page.png", Data: "data:image/png;base64," + strings.Repeat("A", 4096)},
+			maxFileSize: 1024,
+			wantMessage: "file page.png is too large (max: 1024 bytes)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testHandlerConfig(t)
+			if tt.maxFileSize > 0 {
+				cfg.Upload.MaxFileSize = tt.maxFileSize
+			}
+			storage := services.NewMemoryStorage()
+			h := NewHandler(cfg, services.NewPDFService(cfg, storage), services.NewFileService(cfg), storage,
+				services.NewDownloadSigner(cfg), nil, nil)
+
+			body, err := json.Marshal(jsonConvertRequest{Images: []jsonImage{tt.image}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			h.ConvertJSONHandler(rec, httptest.NewRequest(http.MethodPost, "/convert-json", bytes.NewReader(body)))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+			var response models.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("invalid error response %q: %v", rec.Body.String(), err)
+			}
+			if !strings.HasPrefix(response.Error, tt.wantMessage) {
+				t.Errorf("error = %q, want prefix %q", response.Error, tt.wantMessage)
+			}
+			if response.ErrorCode != tt.wantCode {
+				t.Errorf("errorCode = %q, want %q", response.ErrorCode, tt.wantCode)
+			}
+			if objects, _ := storage.List(context.Background(), ""); len(objects) > 0 {
+				t.Errorf("storage holds %d objects after a rejected request", len(objects))
+			}
+		})
+	}
+}
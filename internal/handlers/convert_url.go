@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"img-to-pdf-converter/internal/models"
+	"img-to-pdf-converter/internal/services"
+)
+
+// maxJSONRequestSize limits the size of JSON request bodies that only carry URLs and options
+const maxJSONRequestSize = 1 << 20 // 1MB
+
+// urlConvertRequest is the JSON body of a URL conversion request
+type urlConvertRequest struct {
+	URLs    []string                   `json:"urls"`
+	Options services.ConversionOptions `json:"options"`
+}
+
+// ConvertURLHandler downloads images from a list of URLs and converts them like an upload
+func (h *Handler) ConvertURLHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "Convert URL request received")
+
+	if r.Method != http.MethodPost {
+		h.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request urlConvertRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONRequestSize)).Decode(&request); err != nil {
+		slog.InfoContext(r.Context(), "Invalid JSON body", "error", err)
+		h.sendErrorResponse(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	options, err := h.normalizeConversionOptions(request.Options)
+	if err != nil {
+		h.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "Conversion options", "fit", options.Fit, "position", options.Position, "orientation", options.Orientation, "output_format", options.OutputFormat)
+	slog.InfoContext(r.Context(), "Fetching URLs", "urls", len(request.URLs))
+
+	// Download the images
+	files, err := h.fileService.FetchURLs(r.Context(), request.URLs)
+	if err != nil {
+		h.sendFetchError(w, r, err)
+		return
+	}
+
+	// Validate files
+	files, err = h.fileService.ValidateFiles(r.Context(), files)
+	if err != nil {
+		slog.InfoContext(r.Context(), "File validation failed", "error", err)
+		h.sendValidationError(w, err.Error(), err)
+		return
+	}
+
+	release, ok := h.acquireConversionSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Convert images with options
+	outputName, err := h.pdfService.ConvertImagesToPDFWithOptions(r.Context(), files, options)
+	if err != nil {
+		h.sendConversionError(w, r, err, "Failed to convert images")
+		return
+	}
+
+	// Return success response
+	response := models.UploadResponse{
+		Success:     true,
+		PDFFile:     outputName,
+		Format:      options.OutputFormat,
+		DownloadURL: h.downloadURL(r, outputName),
+		ExpiresAt:   h.outputExpiresAt(),
+		Message:     "Images converted to " + strings.ToUpper(options.OutputFormat) + " successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+
+	slog.InfoContext(r.Context(), "URL conversion completed", "output", outputName)
+}
+
+// sendFetchError reports URLs that couldn't be fetched. Servers that fail or don't answer in time
+// are a 502 or 504, blocked addresses a 422 and other invalid URLs a 400. A cancelled request is
+// handled like a cancelled conversion.
+func (h *Handler) sendFetchError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.InfoContext(r.Context(), "Fetching URLs failed", "error", err)
+	switch {
+	case errors.Is(err, context.Canceled):
+		h.sendConversionError(w, r, err, "Failed to fetch URLs")
+	case errors.Is(err, services.ErrFetchTimeout), errors.Is(err, context.DeadlineExceeded):
+		h.sendErrorResponse(w, err.Error(), http.StatusGatewayTimeout)
+	case errors.Is(err, services.ErrFetchFailed):
+		h.sendErrorResponse(w, err.Error(), http.StatusBadGateway)
+	case errors.Is(err, services.ErrBlockedAddress):
+		h.sendErrorResponse(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		h.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+	}
+}
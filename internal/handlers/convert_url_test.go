@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"img-to-pdf-converter/internal/services"
+)
+
+func TestConvertURLFetchErrors(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		case "/broken":
+			http.Error(w, "broken", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		allowPrivateNetworks bool
+		wantStatus           int
+	}{
+		{name: "invalid URL", url: "file:///etc/passwd", allowPrivateNetworks: true, wantStatus: http.StatusBadRequest},
+		{name: "blocked address", url: upstream.URL + "/broken", wantStatus: http.StatusUnprocessableEntity},
+		{name: "failing server", url: upstream.URL + "/broken", allowPrivateNetworks: true, wantStatus: http.StatusBadGateway},
+		{name: "missing image", url: upstream.URL + "/missing", allowPrivateNetworks: true, wantStatus: http.StatusBadGateway},
+		{name: "slow server", url: upstream.URL + "/slow", allowPrivateNetworks: true, wantStatus: http.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testHandlerConfig(t)
+			cfg.Fetch.Timeout = 50 * time.Millisecond
+			cfg.Fetch.AllowPrivateNetworks = tt.allowPrivateNetworks
+			h := &Handler{config: cfg, fileService: services.NewFileService(cfg)}
+
+			body, _ := json.Marshal(urlConvertRequest{URLs: []string{tt.url}})
+			rec := httptest.NewRecorder()
+			h.ConvertURLHandler(rec, httptest.NewRequest(http.MethodPost, "/convert/url", bytes.NewReader(body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("client gone", func(t *testing.T) {
+		cfg := testHandlerConfig(t)
+		cfg.Fetch.Timeout = time.Minute
+		cfg.Fetch.AllowPrivateNetworks = true
+		h := &Handler{config: cfg, fileService: services.NewFileService(cfg)}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		time.AfterFunc(20*time.Millisecond, cancel)
+		body, _ := json.Marshal(urlConvertRequest{URLs: []string{upstream.URL + "/slow"}})
+		rec := httptest.NewRecorder()
+		h.ConvertURLHandler(rec, httptest.NewRequest(http.MethodPost, "/convert/url", bytes.NewReader(body)).WithContext(ctx))
+
+		// Nobody is left to answer
+		if rec.Body.Len() != 0 {
+			t.Errorf("response to a cancelled request: %d %s", rec.Code, rec.Body.String())
+		}
+	})
+}
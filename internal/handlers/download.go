@@ -1,26 +1,43 @@
 package handlers
 
 import (
-	"log"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+
+	"img-to-pdf-converter/internal/metrics"
+	"img-to-pdf-converter/internal/services"
 )
 
-// DownloadHandler handles PDF file downloads
-// This is a new implementation that will replace the one in handlers.go
-func (h *Handler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== Download Handler  Called ===")
+// downloadContentTypes maps the extensions of generated files to their MIME types
+var downloadContentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".zip":  "application/zip",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+}
 
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// DownloadHandler handles downloads of generated files
+func (h *Handler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "Download request received")
 
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+	// Record the status and size of every download, failed ones included
+	recorder := &downloadRecorder{ResponseWriter: w, status: http.StatusOK}
+	w = recorder
+	defer func() {
+		metrics.Downloads.WithLabelValues(strconv.Itoa(recorder.status)).Inc()
+		if recorder.status < http.StatusMultipleChoices {
+			metrics.DownloadBytes.Add(float64(recorder.written))
+		}
+	}()
 
 	filename := r.URL.Query().Get("file")
 	if filename == "" {
@@ -28,25 +45,97 @@ func (h *Handler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only links handed out by the conversion endpoints are served
+	link, err := h.signer.Verify(r.URL.Query())
+	if errors.Is(err, services.ErrLinkExpired) {
+		h.sendErrorResponse(w, "Download link has expired", http.StatusGone)
+		return
+	}
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid download link", http.StatusForbidden)
+		return
+	}
+
 	// Security check: prevent directory traversal
 	if filepath.Dir(filename) != "." {
 		h.sendErrorResponse(w, "Invalid filename", http.StatusBadRequest)
 		return
 	}
 
-	filePath := filepath.Join(h.config.PDF.OutputDir, filename)
+	// Files that are still being written are never served, a client would get a truncated document
+	if services.IsPartialObjectName(filename) {
+		h.sendErrorResponse(w, "File is still being written", http.StatusConflict)
+		return
+	}
 
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	// Open the file from storage, which may be shared by several replicas.
+	// One-time files are claimed before anything is sent, so concurrent requests can't both get them.
+	// The claim consumes the link even when the transfer is cut off, a one-time link is served at most once.
+	open := h.storage.Get
+	if link.Once {
+		open = h.storage.Claim
+		// The whole file is sent, a claimed file is gone after this request
+		for _, header := range []string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+			r.Header.Del(header)
+		}
+	}
+	file, info, err := open(r.Context(), filename)
+	if errors.Is(err, services.ErrObjectNotFound) {
 		h.sendErrorResponse(w, "File not found", http.StatusNotFound)
 		return
 	}
+	if errors.Is(err, services.ErrObjectInProgress) {
+		h.sendErrorResponse(w, "File is still being written", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to open file from storage", "file", filename, "error", err)
+		h.sendErrorResponse(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
 
 	// Set headers for file download
-	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	contentType, ok := downloadContentTypes[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	// Serve the file, with range requests when the backend allows seeking
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, filename, info.ModTime, seeker)
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		if !info.ModTime.IsZero() {
+			w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+		}
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.Copy(w, file); err != nil {
+			slog.InfoContext(r.Context(), "Failed to send file", "file", filename, "once", link.Once, "error", err)
+			return
+		}
+	}
+	slog.InfoContext(r.Context(), "File served", "file", filename, "once", link.Once)
+}
+
+// downloadRecorder records the status and body size of a download response
+type downloadRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+// WriteHeader records the status code
+func (d *downloadRecorder) WriteHeader(statusCode int) {
+	d.status = statusCode
+	d.ResponseWriter.WriteHeader(statusCode)
+}
 
-	// Serve the file
-	http.ServeFile(w, r, filePath)
-	log.Printf("File served: %s", filePath)
+// Write counts the body bytes written
+func (d *downloadRecorder) Write(p []byte) (int, error) {
+	n, err := d.ResponseWriter.Write(p)
+	d.written += int64(n)
+	return n, err
 }
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"img-to-pdf-converter/internal/config"
+	"img-to-pdf-converter/internal/services"
+)
+
+func TestDownloadOnceConcurrent(t *testing.T) {
+	fsStorage, err := services.NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends := map[string]services.Storage{
+		"memory":     services.NewMemoryStorage(),
+		"filesystem": fsStorage,
+	}
+
+	for name, storage := range backends {
+		t.Run(name, func(t *testing.T) {
+			cfg := &config.Config{Download: config.DownloadConfig{SigningSecret: "secret", LinkTTL: time.Hour}}
+			h := &Handler{config: cfg, storage: storage, signer: services.NewDownloadSigner(cfg)}
+
+			const content = "%PDF-1.4 once"
+			if err := storage.Put(context.Background(), "once.pdf", strings.NewReader(content), int64(len(content))); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			link := h.signer.SignedURL("once.pdf", true)
+
+			const requests = 8
+			var wg sync.WaitGroup
+			responses := make([]*httptest.ResponseRecorder, requests)
+			for i := range responses {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					req := httptest.NewRequest(http.MethodGet, link, nil)
+					// A range request must not leave the rest of the file behind
+					req.Header.Set("Range", "bytes=0-3")
+					responses[i] = httptest.NewRecorder()
+					h.DownloadHandler(responses[i], req)
+				}(i)
+			}
+			wg.Wait()
+
+			served := 0
+			for _, rec := range responses {
+				switch rec.Code {
+				case http.StatusOK:
+					served++
+					if rec.Body.String() != content {
+						t.Errorf("body = %q, want the whole file", rec.Body.String())
+					}
+				case http.StatusNotFound:
+				default:
+					t.Errorf("status = %d, want 200 or 404", rec.Code)
+				}
+			}
+			if served != 1 {
+				t.Errorf("%d requests got the file, want exactly 1", served)
+			}
+
+			objects, err := storage.List(context.Background(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(objects) != 0 {
+				t.Errorf("storage still holds %v", objects)
+			}
+		})
+	}
+}
+
+func TestDownloadReusableLink(t *testing.T) {
+	cfg := &config.Config{Download: config.DownloadConfig{SigningSecret: "secret", LinkTTL: time.Hour}}
+	storage := services.NewMemoryStorage()
+	h := &Handler{config: cfg, storage: storage, signer: services.NewDownloadSigner(cfg)}
+	if err := storage.Put(context.Background(), "doc.pdf", strings.NewReader("%PDF-1.4"), 8); err != nil {
+		t.Fatal(err)
+	}
+	link := h.signer.SignedURL("doc.pdf", false)
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h.DownloadHandler(rec, httptest.NewRequest(http.MethodGet, link, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "%PDF-1.4" {
+			t.Fatalf("download %d = %d %q", i+1, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestDownloadContentDisposition(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{file: "doc.pdf", want: "attachment; filename=doc.pdf"},
+		{file: "my doc; v2.pdf", want: `attachment; filename="my doc; v2.pdf"`},
+		{file: `say "hi".pdf`, want: `attachment; filename="say \"hi\".pdf"`},
+		{file: "résumé.pdf", want: "attachment; filename*=utf-8''r%C3%A9sum%C3%A9.pdf"},
+	}
+
+	cfg := &config.Config{Download: config.DownloadConfig{SigningSecret: "secret", LinkTTL: time.Hour}}
+	storage := services.NewMemoryStorage()
+	h := &Handler{config: cfg, storage: storage, signer: services.NewDownloadSigner(cfg)}
+	for _, tt := range tests {
+		if err := storage.Put(context.Background(), tt.file, strings.NewReader("%PDF-1.4"), 8); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		h.DownloadHandler(rec, httptest.NewRequest(http.MethodGet, h.signer.SignedURL(tt.file, false), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("download of %q status = %d: %s", tt.file, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Disposition"); got != tt.want {
+			t.Errorf("Content-Disposition of %q = %s, want %s", tt.file, got, tt.want)
+		}
+	}
+}
@@ -7,16 +7,53 @@ import (
 	"img-to-pdf-converter/internal/models"
 )
 
-// HealthHandler handles health check requests
-// This is a new implementation that will replace the one in handlers.go
-func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
-	response := models.HealthResponse{
-		Status:  "healthy",
+// LivenessHandler reports that the process is up and serving requests. It stays healthy while
+// draining, restarting a draining instance would abort its running conversions.
+func (h *Handler) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	h.sendHealthResponse(w, models.HealthResponse{
+		Status:  "alive",
 		Message: "Image to PDF Converter is running",
 		Version: h.config.App.Version,
+	}, http.StatusOK)
+}
+
+// ReadinessHandler reports whether the instance can take conversions. It returns 503 with the
+// details of every check when any check fails or the instance is shutting down.
+func (h *Handler) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		h.sendHealthResponse(w, models.HealthResponse{
+			Status:  "draining",
+			Message: "Image to PDF Converter is shutting down",
+			Version: h.config.App.Version,
+		}, http.StatusServiceUnavailable)
+		return
 	}
 
+	response := models.HealthResponse{
+		Status:  "ready",
+		Message: "Image to PDF Converter is ready",
+		Version: h.config.App.Version,
+		Checks:  make(map[string]models.HealthCheck),
+	}
+	statusCode := http.StatusOK
+
+	for _, check := range h.health.Check(r.Context()) {
+		status := "ok"
+		if !check.Healthy {
+			status = "failed"
+			response.Status = "degraded"
+			response.Message = "Image to PDF Converter is not ready"
+			statusCode = http.StatusServiceUnavailable
+		}
+		response.Checks[check.Name] = models.HealthCheck{Status: status, Message: check.Message}
+	}
+
+	h.sendHealthResponse(w, response, statusCode)
+}
+
+// sendHealthResponse sends a health response in JSON format
+func (h *Handler) sendHealthResponse(w http.ResponseWriter, response models.HealthResponse, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(response)
 }
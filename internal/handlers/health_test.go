@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"img-to-pdf-converter/internal/models"
+	"img-to-pdf-converter/internal/services"
+)
+
+// failingStatStorage is a storage whose Stat fails, as an unreachable backend would
+type failingStatStorage struct {
+	*services.MemoryStorage
+}
+
+func (s failingStatStorage) Stat(ctx context.Context, name string) (services.ObjectInfo, error) {
+	return services.ObjectInfo{}, errors.New("connection refused")
+}
+
+// decodeHealthResponse decodes the body of a health response
+func decodeHealthResponse(t *testing.T, rec *httptest.ResponseRecorder) models.HealthResponse {
+	t.Helper()
+	var response models.HealthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid health response %q: %v", rec.Body.String(), err)
+	}
+	return response
+}
+
+func TestReadinessHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		storage    services.Storage
+		draining   bool
+		wantCode   int
+		wantStatus string
+		wantFailed string
+	}{
+		{name: "ready", storage: services.NewMemoryStorage(), wantCode: http.StatusOK, wantStatus: "ready"},
+		{
+			name:       "storage unreachable",
+			storage:    failingStatStorage{services.NewMemoryStorage()},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "degraded",
+			wantFailed: "storage",
+		},
+		{name: "draining", storage: services.NewMemoryStorage(), draining: true, wantCode: http.StatusServiceUnavailable, wantStatus: "draining"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testHandlerConfig(t)
+			for _, dir := range []string{cfg.Upload.TempDir, cfg.Upload.UploadDir, cfg.PDF.OutputDir} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			h := NewHandler(cfg, services.NewPDFService(cfg, tt.storage), services.NewFileService(cfg), tt.storage,
+				services.NewDownloadSigner(cfg), services.NewHealthChecker(cfg, tt.storage, nil), nil)
+			if tt.draining {
+				h.StartDraining()
+			}
+
+			rec := httptest.NewRecorder()
+			h.ReadinessHandler(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			response := decodeHealthResponse(t, rec)
+			if response.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", response.Status, tt.wantStatus)
+			}
+			for name, check := range response.Checks {
+				wantStatus := "ok"
+				if name == tt.wantFailed {
+					wantStatus = "failed"
+				}
+				if check.Status != wantStatus {
+					t.Errorf("check %s = %q (%s), want %q", name, check.Status, check.Message, wantStatus)
+				}
+			}
+			if tt.wantFailed != "" {
+				if _, ok := response.Checks[tt.wantFailed]; !ok {
+					t.Errorf("checks = %v, want a %s check", response.Checks, tt.wantFailed)
+				}
+			}
+
+			// Liveness doesn't depend on readiness, not even while draining
+			rec = httptest.NewRecorder()
+			h.LivenessHandler(rec, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("liveness status = %d, want %d", rec.Code, http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"img-to-pdf-converter/internal/services"
+)
+
+// RateLimit returns middleware that limits the requests of every client IP with limiter.
+// Clients over their rate get a 429 with the seconds until their next request in Retry-After.
+func (h *Handler) RateLimit(limiter *services.RateLimiter) func(http.Handler) http.Handler {
+	trusted := parseTrustedProxies(h.config.Limits.TrustedProxies)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r, trusted)
+			if ok, wait := limiter.Allow(ip); !ok {
+				slog.InfoContext(r.Context(), "Rate limit exceeded", "client_ip", ip)
+				w.Header().Set("Retry-After", retryAfterSeconds(wait))
+				h.sendErrorResponse(w, "Too many requests, please slow down", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// acquireConversionSlot waits for a free conversion slot. Handlers call it once the request is
+// read and validated, so slow uploads don't hold a slot. On success the returned function must
+// be called when the conversion is done. Requests that can't get a slot within the queue timeout
+// or before the server shuts down get a 503, and ok is false.
+func (h *Handler) acquireConversionSlot(w http.ResponseWriter, r *http.Request) (release func(), ok bool) {
+	if h.limiter == nil {
+		return func() {}, true
+	}
+
+	err := h.limiter.Acquire(r.Context())
+	switch {
+	case err == nil:
+		return h.limiter.Release, true
+	case errors.Is(err, services.ErrServerBusy):
+		slog.WarnContext(r.Context(), "All conversion slots are busy, rejecting request", "slots", h.limiter.InFlight())
+		w.Header().Set("Retry-After", retryAfterSeconds(h.config.Limits.QueueTimeout))
+		h.sendErrorResponse(w, "Server is busy, please retry later", http.StatusServiceUnavailable)
+	case errors.Is(err, services.ErrShuttingDown):
+		// Nothing has been converted yet, so the client can safely send the request again
+		slog.InfoContext(r.Context(), "Rejecting queued request, server is shutting down")
+		w.Header().Set("Retry-After", "1")
+		w.Header().Set("Connection", "close")
+		h.sendErrorResponse(w, "Server is shutting down, please retry", http.StatusServiceUnavailable)
+	default:
+		slog.InfoContext(r.Context(), "Request cancelled while waiting for a conversion slot")
+	}
+	return nil, false
+}
+
+// clientIP returns the IP of the client that sent r. Behind trusted proxies such as our nginx,
+// it is the rightmost X-Forwarded-For address that isn't a trusted proxy itself, since clients
+// can put anything at the start of the header.
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !isTrustedProxy(ip, trusted) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+// parseTrustedProxies parses the trusted proxy CIDRs, skipping invalid entries
+func parseTrustedProxies(cidrs []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			slog.Warn("Ignoring invalid trusted proxy", "cidr", cidr, "error", err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// isTrustedProxy reports whether ip belongs to one of the trusted networks
+func isTrustedProxy(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfterSeconds formats a wait for the Retry-After header, rounded up to whole seconds
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"img-to-pdf-converter/internal/config"
+	"img-to-pdf-converter/internal/services"
+)
+
+// testHandlerConfig returns a configuration with small limits and directories inside the test's temp dir
+func testHandlerConfig(t *testing.T) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	return &config.Config{
+		Upload: config.UploadConfig{
+			MaxFileSize:        1 << 20,
+			MaxTypeSizes:       map[string]int64{},
+			MaxRequestSize:     4 << 20,
+			MaxFiles:           10,
+			MaxImageWidth:      20000,
+			MaxImageHeight:     20000,
+			MaxImageMegapixels: 100,
+			AllowedTypes:       []string{"image/jpeg", "image/png", "image/gif", "application/pdf"},
+			TempDir:            dir + "/temp",
+			UploadDir:          dir + "/uploads",
+		},
+		PDF: config.PDFConfig{
+			OutputDir:        dir + "/output",
+			Orientation:      "P",
+			DefaultRasterDPI: 150,
+			MaxRasterDPI:     600,
+		},
+		Limits: config.LimitsConfig{
+			MaxConcurrentConversions: 1,
+			QueueTimeout:             50 * time.Millisecond,
+		},
+		Download: config.DownloadConfig{SigningSecret: "secret", LinkTTL: time.Hour},
+	}
+}
+
+// multipartUpload builds an upload request with the given files, each a field name and its content
+func multipartUpload(t *testing.T, target string, contentType string, files map[string][]byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, data := range files {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="`+name+`"; filename="`+name+`.bin"`)
+		header.Set("Content-Type", contentType)
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(data)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestConversionSlotTakenAfterValidation(t *testing.T) {
+	cfg := testHandlerConfig(t)
+	limiter := services.NewConversionLimiter(cfg.Limits.MaxConcurrentConversions, cfg.Limits.QueueTimeout)
+	storage := services.NewMemoryStorage()
+	h := NewHandler(cfg, services.NewPDFService(cfg, storage), services.NewFileService(cfg), storage,
+		services.NewDownloadSigner(cfg), nil, limiter)
+
+	var encoded bytes.Buffer
+	png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 4, 4)))
+
+	// A running conversion holds the only slot
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests that fail validation are answered without waiting for a slot
+	rec := httptest.NewRecorder()
+	h.UploadHandler(rec, multipartUpload(t, "/upload?outputFormat=bmp", "image/png", map[string][]byte{"images": encoded.Bytes()}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid options status = %d, want 400", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.UploadHandler(rec, multipartUpload(t, "/upload", "text/plain", map[string][]byte{"images": []byte("not an image")}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid file status = %d, want 400", rec.Code)
+	}
+
+	// Valid requests wait for the slot and give up after the queue timeout
+	rec = httptest.NewRecorder()
+	h.UploadHandler(rec, multipartUpload(t, "/upload", "image/png", map[string][]byte{"images": encoded.Bytes()}))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("busy status = %d, Retry-After %q, want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// Once the slot is free the same request is converted, and the slot is given back
+	limiter.Release()
+	rec = httptest.NewRecorder()
+	h.UploadHandler(rec, multipartUpload(t, "/upload", "image/png", map[string][]byte{"images": encoded.Bytes()}))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	if n := limiter.InFlight(); n != 0 {
+		t.Errorf("%d slots still taken after the conversion", n)
+	}
+}
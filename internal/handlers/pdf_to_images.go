@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"img-to-pdf-converter/internal/models"
+	"img-to-pdf-converter/internal/services"
+)
+
+// PDFToImagesHandler handles PDF uploads and renders their pages as images
+func (h *Handler) PDFToImagesHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "PDF to images request received")
+
+	if r.Method != http.MethodPost {
+		h.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form
+	if err := h.parseUploadForm(w, r); err != nil {
+		return
+	}
+
+	// Parse rendering options from query parameters or form data
+	formatValue := strings.ToLower(getFirstNonEmpty(r.URL.Query().Get("format"), r.FormValue("format"), "png"))
+	if formatValue == "jpg" {
+		formatValue = "jpeg"
+	}
+
+	dpi := h.config.PDF.DefaultRasterDPI
+	if dpiValue := getFirstNonEmpty(r.URL.Query().Get("dpi"), r.FormValue("dpi")); dpiValue != "" {
+		parsed, err := strconv.Atoi(dpiValue)
+		if err != nil {
+			h.sendErrorResponse(w, "Invalid dpi value", http.StatusBadRequest)
+			return
+		}
+		dpi = parsed
+	}
+
+	options := services.RasterOptions{
+		Format: formatValue,
+		DPI:    dpi,
+		Zip:    getFirstNonEmpty(r.URL.Query().Get("output"), r.FormValue("output"), "zip") == "zip",
+	}
+
+	// Reject bad options before the upload is validated
+	if options.Format != "png" && options.Format != "jpeg" {
+		h.sendErrorResponse(w, "Unsupported image format: "+options.Format, http.StatusBadRequest)
+		return
+	}
+	if options.DPI <= 0 || options.DPI > h.config.PDF.MaxRasterDPI {
+		h.sendErrorResponse(w, "DPI must be between 1 and "+strconv.Itoa(h.config.PDF.MaxRasterDPI), http.StatusBadRequest)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "Rendering options", "format", options.Format, "dpi", options.DPI, "zip", options.Zip)
+
+	// Get the uploaded PDF - accept both 'file' and 'files' field names
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		files = r.MultipartForm.File["files"]
+	}
+	if len(files) != 1 {
+		h.sendErrorResponse(w, "Exactly one PDF file must be uploaded", http.StatusBadRequest)
+		return
+	}
+
+	if files[0].Header.Get("Content-Type") != services.PDFContentType {
+		h.sendErrorResponse(w, "Uploaded file is not a PDF document", http.StatusBadRequest)
+		return
+	}
+
+	// Validate file
+	inputs, err := h.fileService.ValidateFiles(r.Context(), services.NewMultipartInputs(files))
+	if err != nil {
+		slog.InfoContext(r.Context(), "File validation failed", "error", err)
+		h.sendValidationError(w, err.Error(), err)
+		return
+	}
+
+	release, ok := h.acquireConversionSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	outputs, err := h.pdfService.ConvertPDFToImages(r.Context(), inputs[0], options)
+	if err != nil {
+		h.sendConversionError(w, r, err, "Failed to convert PDF to images")
+		return
+	}
+
+	// Return success response
+	response := models.PDFToImagesResponse{
+		Success:   true,
+		ExpiresAt: h.outputExpiresAt(),
+		Message:   "PDF converted to images successfully",
+	}
+	if options.Zip {
+		response.ZipFile = outputs[0]
+		response.ZipURL = h.downloadURL(r, outputs[0])
+	} else {
+		for _, output := range outputs {
+			response.Images = append(response.Images, output)
+			response.ImageURLs = append(response.ImageURLs, h.downloadURL(r, output))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+
+	slog.InfoContext(r.Context(), "PDF to images completed", "outputs", len(outputs))
+}
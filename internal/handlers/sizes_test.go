@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"img-to-pdf-converter/internal/models"
+	"img-to-pdf-converter/internal/services"
+)
+
+// uploadPart is a file of a multipart upload
+type uploadPart struct {
+	name        string
+	contentType string
+	data        []byte
+}
+
+// multipartImages builds an upload request with every part as one of the images
+func multipartImages(t *testing.T, parts ...uploadPart) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, file := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="images"; filename="`+file.name+`"`)
+		header.Set("Content-Type", file.contentType)
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(file.data)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// noisePNG returns a PNG of random pixels, which doesn't compress, so its size grows with its dimensions
+func noisePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	random := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(random.Intn(256)), G: uint8(random.Intn(256)), B: uint8(random.Intn(256)), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// padded returns data followed by zeros up to size bytes
+func padded(data []byte, size int) []byte {
+	return append(data, make([]byte, size-len(data))...)
+}
+
+// sizeLimitsHandler returns a handler with a default file size of 4KB, a larger limit for PNG and a smaller one for GIF
+func sizeLimitsHandler(t *testing.T, maxRequestSize int64) *Handler {
+	t.Helper()
+	cfg := testHandlerConfig(t)
+	cfg.Upload.MaxFileSize = 4 << 10
+	cfg.Upload.MaxTypeSizes = map[string]int64{"image/png": 64 << 10, "image/gif": 1 << 10}
+	cfg.Upload.MaxRequestSize = maxRequestSize
+	storage := services.NewMemoryStorage()
+	return NewHandler(cfg, services.NewPDFService(cfg, storage), services.NewFileService(cfg), storage,
+		services.NewDownloadSigner(cfg), nil, nil)
+}
+
+// decodeErrorResponse decodes the body of an error response
+func decodeErrorResponse(t *testing.T, rec *httptest.ResponseRecorder) models.ErrorResponse {
+	t.Helper()
+	var response models.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid error response %q: %v", rec.Body.String(), err)
+	}
+	return response
+}
+
+func TestUploadPerTypeSizeLimits(t *testing.T) {
+	large := noisePNG(t, 64, 64)
+	if len(large) <= 4<<10 {
+		t.Fatalf("test PNG has %d bytes, want more than the default limit", len(large))
+	}
+
+	tests := []struct {
+		name        string
+		part        uploadPart
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name:       "over the default limit within the type's own",
+			part:       uploadPart{name: "large.png", contentType: "image/png", data: large},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "over the type's own smaller limit",
+			part:        uploadPart{name: "small.gif", contentType: "image/gif", data: padded(gifHeader(10, 10), 2<<10)},
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "file small.gif is too large: 2048 bytes (max: 1024 bytes)",
+		},
+		{
+			name:        "over the default limit without an own limit",
+			part:        uploadPart{name: "photo.jpg", contentType: "image/jpeg", data: padded(jpegHeader(10, 10), 5<<10)},
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "file photo.jpg is too large: 5120 bytes (max: 4096 bytes)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := sizeLimitsHandler(t, 1<<20)
+			rec := httptest.NewRecorder()
+			h.UploadHandler(rec, multipartImages(t, tt.part))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK {
+				return
+			}
+			response := decodeErrorResponse(t, rec)
+			if response.Error != tt.wantMessage || response.ErrorCode != "too_large" {
+				t.Errorf("error = %q (%s), want %q (too_large)", response.Error, response.ErrorCode, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestUploadRequestSizeLimit(t *testing.T) {
+	large := noisePNG(t, 64, 64)
+
+	t.Run("files within their limits over the request limit", func(t *testing.T) {
+		h := sizeLimitsHandler(t, int64(len(large))+100)
+		rec := httptest.NewRecorder()
+		h.UploadHandler(rec, multipartImages(t,
+			uploadPart{name: "a.png", contentType: "image/png", data: large},
+			uploadPart{name: "b.png", contentType: "image/png", data: large}))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+		}
+		response := decodeErrorResponse(t, rec)
+		if !strings.HasPrefix(response.Error, "upload is too large") || response.ErrorCode != "too_large" {
+			t.Errorf("error = %q (%s), want the request size error", response.Error, response.ErrorCode)
+		}
+	})
+
+	t.Run("body over the request limit", func(t *testing.T) {
+		h := sizeLimitsHandler(t, 8<<10)
+		rec := httptest.NewRecorder()
+		// The body is cut off once it passes the limit and the room for form fields
+		h.UploadHandler(rec, multipartImages(t, uploadPart{name: "huge.png", contentType: "image/png", data: padded(pngHeader(10, 10), 2<<20)}))
+
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusRequestEntityTooLarge, rec.Body.String())
+		}
+		if response := decodeErrorResponse(t, rec); response.Error != "Upload is too large (max: 8192 bytes)" {
+			t.Errorf("error = %q", response.Error)
+		}
+	})
+}
+
+func TestConvertJSONPerTypeSizeLimits(t *testing.T) {
+	large := noisePNG(t, 64, 64)
+
+	tests := []struct {
+		name        string
+		image       jsonImage
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			// Decoding is bounded by the largest limit of any type, the type's own limit applies on validation
+			name:       "over the default limit within the type's own",
+			image:      jsonImage{Name: "large.png", Data: base64.StdEncoding.EncodeToString(large), Mime: "image/png"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "over the type's own smaller limit",
+			image:       jsonImage{Name: "small.gif", Data: base64.StdEncoding.EncodeToString(padded(gifHeader(10, 10), 2<<10)), Mime: "image/gif"},
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "file small.gif is too large: 2048 bytes (max: 1024 bytes)",
+		},
+		{
+			name:        "over the largest limit of any type",
+			image:       jsonImage{Name: "huge.png", Data: base64.StdEncoding.EncodeToString(padded(pngHeader(10, 10), 65<<10)), Mime: "image/png"},
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "file huge.png is too large (max: 65536 bytes)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := sizeLimitsHandler(t, 1<<20)
+			body, err := json.Marshal(jsonConvertRequest{Images: []jsonImage{tt.image}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			h.ConvertJSONHandler(rec, httptest.NewRequest(http.MethodPost, "/convert", bytes.NewReader(body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if response := decodeErrorResponse(t, rec); response.Error != tt.wantMessage {
+					t.Errorf("error = %q, want %q", response.Error, tt.wantMessage)
+				}
+			}
+		})
+	}
+}
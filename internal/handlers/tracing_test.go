@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"img-to-pdf-converter/internal/services"
+	"img-to-pdf-converter/internal/tracing"
+)
+
+// withTestTracer installs a tracer provider that keeps the spans in memory, sampling like the service does
+func withTestTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())))
+
+	previous := otel.GetTracerProvider()
+	tracing.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	})
+	return exporter
+}
+
+func TestUploadTracing(t *testing.T) {
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+
+	tests := []struct {
+		name        string
+		traceparent string
+		wantSpans   bool
+		wantTraceID string
+	}{
+		{name: "new trace", wantSpans: true},
+		{name: "sampled caller", traceparent: "00-" + traceID + "-" + parentSpanID + "-01", wantSpans: true, wantTraceID: traceID},
+		{name: "unsampled caller", traceparent: "00-" + traceID + "-" + parentSpanID + "-00", wantSpans: false},
+		{name: "invalid traceparent", traceparent: "00-" + traceID + "-0000000000000000-01", wantSpans: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := withTestTracer(t)
+
+			cfg := testHandlerConfig(t)
+			storage := services.NewMemoryStorage()
+			h := NewHandler(cfg, services.NewPDFService(cfg, storage), services.NewFileService(cfg), storage,
+				services.NewDownloadSigner(cfg), nil, nil)
+			router := chi.NewRouter()
+			router.Use(middleware.RequestID)
+			router.Use(tracing.Middleware)
+			router.Post("/upload", h.UploadHandler)
+
+			var encoded bytes.Buffer
+			png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 4, 4)))
+			req := multipartUpload(t, "/upload", "image/png", map[string][]byte{"images": encoded.Bytes()})
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+
+			spans := exporter.GetSpans()
+			if !tt.wantSpans {
+				if len(spans) != 0 {
+					t.Errorf("got %d spans for an unsampled trace, want none", len(spans))
+				}
+				return
+			}
+
+			byName := make(map[string]tracetest.SpanStub, len(spans))
+			for _, span := range spans {
+				byName[span.Name] = span
+			}
+			server, ok := byName["POST /upload"]
+			if !ok {
+				t.Fatalf("no server span named after the route in %v", spanNames(spans))
+			}
+			if server.SpanKind != trace.SpanKindServer {
+				t.Errorf("server span kind = %v", server.SpanKind)
+			}
+			if tt.wantTraceID != "" {
+				if got := server.SpanContext.TraceID().String(); got != tt.wantTraceID {
+					t.Errorf("trace ID = %s, want the caller's %s", got, tt.wantTraceID)
+				}
+				if got := server.Parent.SpanID().String(); got != parentSpanID {
+					t.Errorf("parent span ID = %s, want the caller's %s", got, parentSpanID)
+				}
+			} else if server.Parent.IsValid() {
+				t.Errorf("server span has parent %s, want a new trace", server.Parent.SpanID())
+			}
+
+			// Every step is a descendant of the server span in the same trace
+			for _, name := range []string{"UploadHandler", "UploadHandler.ParseMultipartForm", "FileService.ValidateFiles",
+				"PDFService.ConvertImagesToWriter", "converter.register_image", "PDFService.storeFile"} {
+				span, ok := byName[name]
+				if !ok {
+					t.Errorf("missing span %s in %v", name, spanNames(spans))
+					continue
+				}
+				if span.SpanContext.TraceID() != server.SpanContext.TraceID() {
+					t.Errorf("span %s is in trace %s, want %s", name, span.SpanContext.TraceID(), server.SpanContext.TraceID())
+				}
+			}
+			if byName["UploadHandler"].Parent.SpanID() != server.SpanContext.SpanID() {
+				t.Error("UploadHandler span is not a child of the server span")
+			}
+		})
+	}
+}
+
+// spanNames lists the names of the spans for error messages
+func spanNames(spans tracetest.SpanStubs) []string {
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	return names
+}
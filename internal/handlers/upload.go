@@ -2,109 +2,182 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
-	"path/filepath"
+	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"img-to-pdf-converter/internal/metrics"
 	"img-to-pdf-converter/internal/models"
 	"img-to-pdf-converter/internal/services"
+	"img-to-pdf-converter/internal/tracing"
 )
 
 // UploadHandler handles file uploads and PDF conversion
-// This is a new implementation that will replace the one in handlers.go
 func (h *Handler) UploadHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== Upload Handler  Called ===")
-	log.Printf("Method: %s", r.Method)
-	log.Printf("Content-Type: %s", r.Header.Get("Content-Type"))
-	log.Printf("Content-Length: %s", r.Header.Get("Content-Length"))
-
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+	slog.DebugContext(r.Context(), "Upload request received", "content_length", r.ContentLength)
 
 	if r.Method != http.MethodPost {
 		h.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Parse multipart form
-	err := r.ParseMultipartForm(h.config.Upload.MaxFileSize)
+	ctx, span := tracing.Start(r.Context(), "UploadHandler", attribute.Int64("http.request.body.size", r.ContentLength))
+	r = r.WithContext(ctx)
+
+	// Count the upload once its outcome is known, requests that never reach the conversion are rejected
+	result := "rejected"
+	defer func() {
+		metrics.Uploads.WithLabelValues(result).Inc()
+		span.SetAttributes(attribute.String("upload.result", result))
+		span.End()
+	}()
+
+	// Receiving the upload is often the slow part, so it gets a span of its own
+	_, parseSpan := tracing.Start(ctx, "UploadHandler.ParseMultipartForm")
+	err := h.parseUploadForm(w, r)
+	tracing.End(parseSpan, err)
 	if err != nil {
-		log.Printf("Error parsing multipart form: %v", err)
-		h.sendErrorResponse(w, "Failed to parse form data", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Multipart form parsed successfully")
-	log.Printf("Form keys: %v", getStringMapKeys(r.MultipartForm.Value))
-	log.Printf("File keys: %v", getFileMapKeys(r.MultipartForm.File))
+	slog.DebugContext(r.Context(), "Multipart form parsed",
+		"form_keys", getStringMapKeys(r.MultipartForm.Value),
+		"file_keys", getFileMapKeys(r.MultipartForm.File))
 
 	// Parse conversion options from query parameters or form data
-	positionValue := getFirstNonEmpty(r.URL.Query().Get("position"), r.FormValue("position"))
-	if positionValue == "" {
-		positionValue = "center"
-	}
-
-	orientationValue := getFirstNonEmpty(r.URL.Query().Get("orientation"), r.FormValue("orientation"))
-	if orientationValue == "" {
-		orientationValue = "P"
+	options, err := h.parseConversionOptions(r, "")
+	if err != nil {
+		h.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	options := services.ConversionOptions{
-		Fit:         r.URL.Query().Get("fit") == "true" || r.FormValue("fit") == "true",
-		Position:    positionValue,
-		Orientation: orientationValue,
+	slog.DebugContext(r.Context(), "Conversion options", "fit", options.Fit, "position", options.Position, "orientation", options.Orientation, "output_format", options.OutputFormat)
+	span.SetAttributes(
+		attribute.Bool("options.fit", options.Fit),
+		attribute.String("options.position", options.Position),
+		attribute.String("options.orientation", options.Orientation),
+		attribute.String("options.format", options.OutputFormat))
+
+	// The document is returned as JSON with a download filename, or with response=pdf as the response body
+	responseMode := getFirstNonEmpty(r.URL.Query().Get("response"), r.FormValue("response"), "json")
+	if responseMode != "json" && responseMode != "pdf" {
+		h.sendErrorResponse(w, "Invalid response mode: "+responseMode, http.StatusBadRequest)
+		return
 	}
 
-	log.Printf("Conversion options: fit=%t, position=%s, orientation=%s", options.Fit, options.Position, options.Orientation)
-
 	// Get uploaded files - try both 'images' and 'files' field names
 	files := r.MultipartForm.File["images"]
 	if len(files) == 0 {
 		files = r.MultipartForm.File["files"]
 	}
 	if len(files) == 0 {
-		log.Printf("No files found in form data")
+		slog.InfoContext(r.Context(), "No files found in form data")
 		h.sendErrorResponse(w, "No files uploaded", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Found %d files", len(files))
+	// Only the part's content type is logged, the raw part headers may carry client details
+	var uploadBytes int64
 	for i, file := range files {
-		log.Printf("File %d: name=%s, size=%d, header=%v", i, file.Filename, file.Size, file.Header)
+		slog.DebugContext(r.Context(), "Uploaded file", "index", i, "name", file.Filename, "bytes", file.Size,
+			"content_type", file.Header.Get("Content-Type"))
+		uploadBytes += file.Size
 	}
+	span.SetAttributes(attribute.Int("files.count", len(files)), attribute.Int64("files.bytes", uploadBytes))
 
 	// Validate files
-	if err := h.fileService.ValidateFiles(files); err != nil {
-		log.Printf("File validation failed: %v", err)
-		h.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+	inputs, err := h.fileService.ValidateFiles(r.Context(), services.NewMultipartInputs(files))
+	if err != nil {
+		slog.InfoContext(r.Context(), "File validation failed", "error", err)
+		h.sendValidationError(w, err.Error(), err)
+		return
+	}
+	// Only accepted uploads are counted, rejected ones show up in the rejection metrics
+	metrics.UploadBytes.Add(float64(uploadBytes))
+	metrics.UploadFiles.Observe(float64(len(inputs)))
+
+	release, ok := h.acquireConversionSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	result = "failed"
+
+	if responseMode == "pdf" {
+		if h.streamConversion(w, r, inputs, options) {
+			result = "success"
+		}
 		return
 	}
 
 	// Convert images to PDF with options
-	pdfPath, err := h.pdfService.ConvertImagesToPDFWithOptions(files, options)
+	pdfName, err := h.pdfService.ConvertImagesToPDFWithOptions(r.Context(), inputs, options)
 	if err != nil {
-		log.Printf("PDF conversion failed: %v", err)
-		h.sendErrorResponse(w, "Failed to convert images to PDF", http.StatusInternalServerError)
+		h.sendConversionError(w, r, err, "Failed to convert images to PDF")
 		return
 	}
+	result = "success"
 
 	// Return success response
 	response := models.UploadResponse{
-		Success: true,
-		PDFFile: filepath.Base(pdfPath),
-		Message: "Images converted to PDF successfully",
+		Success:     true,
+		PDFFile:     pdfName,
+		Format:      options.OutputFormat,
+		DownloadURL: h.downloadURL(r, pdfName),
+		ExpiresAt:   h.outputExpiresAt(),
+		Message:     "Images converted to " + strings.ToUpper(options.OutputFormat) + " successfully",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 
-	log.Printf("Upload completed successfully, PDF: %s", pdfPath)
+	slog.InfoContext(r.Context(), "Upload completed", "output", pdfName, "files", len(inputs))
+}
+
+// streamConversion writes the converted document directly into the response, skipping the output directory.
+// It reports whether the conversion succeeded.
+func (h *Handler) streamConversion(w http.ResponseWriter, r *http.Request, inputs []services.ImageInput, options services.ConversionOptions) bool {
+	filename := "converted_images." + options.OutputFormat
+	stream := &responseStream{
+		w:           w,
+		contentType: downloadContentTypes["."+options.OutputFormat],
+		filename:    filename,
+	}
+
+	if err := h.pdfService.ConvertImagesToWriter(r.Context(), inputs, options, stream); err != nil {
+		if stream.started {
+			// Part of the document was already sent, only aborting the connection tells the client
+			slog.ErrorContext(r.Context(), "Conversion failed after the response started", "error", err)
+			panic(http.ErrAbortHandler)
+		}
+		h.sendConversionError(w, r, err, "Failed to convert images to PDF")
+		return false
+	}
+
+	slog.InfoContext(r.Context(), "Upload completed", "streamed", filename, "files", len(inputs))
+	return true
+}
+
+// responseStream sends the download headers with the first write, so a conversion
+// that fails before producing output can still answer with a JSON error
+type responseStream struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+// Write writes document data to the response
+func (s *responseStream) Write(p []byte) (int, error) {
+	if !s.started {
+		s.w.Header().Set("Content-Type", s.contentType)
+		s.w.Header().Set("Content-Disposition", "attachment; filename="+s.filename)
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+	return s.w.Write(p)
 }
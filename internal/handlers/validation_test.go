@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"img-to-pdf-converter/internal/models"
+	"img-to-pdf-converter/internal/services"
+)
+
+// pngHeader returns the start of a PNG file declaring the given size, without any pixel data
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 0, 17)
+	ihdr = append(ihdr, "IHDR"...)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 2, 0, 0, 0) // 8 bit RGB, no interlacing
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+// gifHeader returns the start of a GIF file declaring the given screen size, without any frames
+func gifHeader(width, height uint16) []byte {
+	data := []byte("GIF89a")
+	data = binary.LittleEndian.AppendUint16(data, width)
+	data = binary.LittleEndian.AppendUint16(data, height)
+	return append(data, 0, 0, 0) // No global color table
+}
+
+// jpegHeader returns the start of a JPEG file declaring the given size, without any scan data
+func jpegHeader(width, height uint16) []byte {
+	data := []byte{0xff, 0xd8}
+	// A JFIF marker tells the decoder the color space, so it stops reading at the frame header
+	data = append(data, 0xff, 0xe0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0)
+	data = append(data, 0xff, 0xc0, 0x00, 0x11, 8)
+	data = binary.BigEndian.AppendUint16(data, height)
+	data = binary.BigEndian.AppendUint16(data, width)
+	return append(data, 3, 1, 0x11, 0, 2, 0x11, 1, 3, 0x11, 1) // Three components, no subsampling
+}
+
+// testPDF returns a PDF document with a single A4 page
+func testPDF(t *testing.T) []byte {
+	t.Helper()
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AddPage()
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatalf("failed to create test PDF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// decodeErrorCode returns the errorCode of an error response
+func decodeErrorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response models.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid error response %q: %v", rec.Body.String(), err)
+	}
+	return response.ErrorCode
+}
+
+func TestUploadRejectsImageBombs(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+		wantCode    string
+	}{
+		{name: "PNG bomb", contentType: "image/png", data: pngHeader(20000, 20000), wantCode: "too_many_pixels"},
+		{name: "GIF bomb", contentType: "image/gif", data: gifHeader(20000, 20000), wantCode: "too_many_pixels"},
+		{name: "JPEG bomb", contentType: "image/jpeg", data: jpegHeader(20000, 20000), wantCode: "too_many_pixels"},
+		{name: "PNG too wide", contentType: "image/png", data: pngHeader(30000, 10), wantCode: "image_dimensions"},
+		{name: "GIF too high", contentType: "image/gif", data: gifHeader(10, 65535), wantCode: "image_dimensions"},
+		{name: "JPEG too wide", contentType: "image/jpeg", data: jpegHeader(65535, 10), wantCode: "image_dimensions"},
+		{name: "unreadable header", contentType: "image/png", data: []byte("not an image"), wantCode: "invalid_image"},
+		{name: "truncated header", contentType: "image/jpeg", data: jpegHeader(100, 100)[:8], wantCode: "invalid_image"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testHandlerConfig(t)
+			storage := services.NewMemoryStorage()
+			h := NewHandler(cfg, services.NewPDFService(cfg, storage), services.NewFileService(cfg), storage,
+				services.NewDownloadSigner(cfg), nil, nil)
+
+			rec := httptest.NewRecorder()
+			h.UploadHandler(rec, multipartUpload(t, "/upload", tt.contentType, map[string][]byte{"images": tt.data}))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+			if code := decodeErrorCode(t, rec); code != tt.wantCode {
+				t.Errorf("errorCode = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRenderedPagePixelLimit(t *testing.T) {
+	// An A4 page is about 2.2 megapixels at 150 DPI and 34.8 megapixels at 600 DPI
+	tests := []struct {
+		name   string
+		target string
+		field  string
+	}{
+		{name: "PDF to images", target: "/pdf-to-images?dpi=600", field: "file"},
+		{name: "TIFF output", target: "/upload?outputFormat=tiff", field: "images"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testHandlerConfig(t)
+			cfg.Upload.MaxImageMegapixels = 2
+			storage := services.NewMemoryStorage()
+			h := NewHandler(cfg, services.NewPDFService(cfg, storage), services.NewFileService(cfg), storage,
+				services.NewDownloadSigner(cfg), nil, nil)
+
+			rec := httptest.NewRecorder()
+			req := multipartUpload(t, tt.target, services.PDFContentType, map[string][]byte{tt.field: testPDF(t)})
+			if tt.field == "file" {
+				h.PDFToImagesHandler(rec, req)
+			} else {
+				h.UploadHandler(rec, req)
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+			if code := decodeErrorCode(t, rec); code != "too_many_pixels" {
+				t.Errorf("errorCode = %q, want too_many_pixels", code)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Package logging sets up structured JSON logging with log/slog. Records logged with a request
+// context carry the request ID that chi's RequestID middleware assigned to the request, and the
+// trace ID when the request is traced.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"img-to-pdf-converter/internal/config"
+	"img-to-pdf-converter/internal/tracing"
+)
+
+// New creates a JSON logger writing to w. Debug records are only written in debug mode.
+func New(cfg *config.Config, w io.Writer) *slog.Logger {
+	level := slog.LevelInfo
+	if cfg.Server.Debug {
+		level = slog.LevelDebug
+	}
+
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		// Durations read better as "2m0s" than as nanoseconds
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Value.Kind() == slog.KindDuration {
+				return slog.String(attr.Key, attr.Value.Duration().String())
+			}
+			return attr
+		},
+	})
+	return slog.New(contextHandler{Handler: handler}).With(
+		"service", cfg.App.Name,
+		"version", cfg.App.Version,
+	)
+}
+
+// contextHandler adds the request and trace IDs from the record's context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle adds the request and trace ID attributes and passes the record on
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := middleware.GetReqID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if id := tracing.TraceID(ctx); id != "" {
+		record.AddAttrs(slog.String("trace_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs keeps the request ID handling for loggers with extra attributes
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps the request ID handling for grouped loggers
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
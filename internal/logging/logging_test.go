@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"img-to-pdf-converter/internal/config"
+)
+
+// testConfig returns a configuration naming the service for log records
+func testConfig(debug bool) *config.Config {
+	return &config.Config{
+		App:    config.AppConfig{Name: "img-to-pdf", Version: "1.2.3"},
+		Server: config.ServerConfig{Debug: debug},
+	}
+}
+
+// decodeRecords parses the JSON records written to buf, one per line
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("record %q is not JSON: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNewWritesJSONRecords(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(testConfig(false), &buf)
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "host/abc-000001")
+
+	logger.InfoContext(ctx, "Converted", "pages", 3, "took", 2*time.Minute)
+	logger.With("component", "janitor").WarnContext(ctx, "Grouped", slog.Group("file", "name", "a.png"))
+	logger.Info("Without request")
+	logger.DebugContext(ctx, "Not written outside debug mode")
+
+	records := decodeRecords(t, &buf)
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3: %s", len(records), buf.String())
+	}
+
+	want := map[string]any{
+		"level":      "INFO",
+		"msg":        "Converted",
+		"service":    "img-to-pdf",
+		"version":    "1.2.3",
+		"request_id": "host/abc-000001",
+		"pages":      float64(3),
+		"took":       "2m0s",
+	}
+	for key, value := range want {
+		if records[0][key] != value {
+			t.Errorf("record[%q] = %v, want %v", key, records[0][key], value)
+		}
+	}
+	if _, ok := records[0]["time"]; !ok {
+		t.Error("record has no time")
+	}
+
+	// Loggers derived with attributes still add the request ID
+	if records[1]["request_id"] != "host/abc-000001" || records[1]["component"] != "janitor" {
+		t.Errorf("record with attributes = %v, want request_id and component", records[1])
+	}
+
+	if _, ok := records[2]["request_id"]; ok {
+		t.Errorf("record without request context = %v, want no request_id", records[2])
+	}
+}
+
+func TestNewDebugMode(t *testing.T) {
+	var buf bytes.Buffer
+	New(testConfig(true), &buf).Debug("Written in debug mode")
+
+	records := decodeRecords(t, &buf)
+	if len(records) != 1 || records[0]["level"] != "DEBUG" {
+		t.Errorf("records = %v, want one debug record", records)
+	}
+}
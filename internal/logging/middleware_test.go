@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// withTestLogger makes a JSON logger writing to the returned buffer the default logger for the test
+func withTestLogger(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(New(testConfig(false), &buf))
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+	})
+	return &buf
+}
+
+func TestRequestLogger(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus float64
+		wantBytes  float64
+		wantLevel  string
+	}{
+		{
+			name: "success",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("created"))
+			},
+			wantStatus: http.StatusCreated,
+			wantBytes:  7,
+			wantLevel:  "INFO",
+		},
+		{
+			name: "implicit status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			},
+			wantStatus: http.StatusOK,
+			wantBytes:  2,
+			wantLevel:  "INFO",
+		},
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "failed", http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantBytes:  7,
+			wantLevel:  "ERROR",
+		},
+		{
+			name:       "nothing written",
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantStatus: 499,
+			wantLevel:  "INFO",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := withTestLogger(t)
+			handler := middleware.RequestID(RequestIDResponse(RequestLogger(tt.handler)))
+
+			req := httptest.NewRequest(http.MethodGet, "/download?file=a.pdf&signature=secret", nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(RequestIDHeader)
+			if id == "" {
+				t.Fatalf("response has no %s header", RequestIDHeader)
+			}
+
+			records := decodeRecords(t, buf)
+			if len(records) != 1 {
+				t.Fatalf("got %d records, want 1: %s", len(records), buf.String())
+			}
+			record := records[0]
+			want := map[string]any{
+				"msg":         "Request served",
+				"level":       tt.wantLevel,
+				"method":      http.MethodGet,
+				"path":        "/download",
+				"status":      tt.wantStatus,
+				"bytes":       tt.wantBytes,
+				"remote_addr": req.RemoteAddr,
+				"request_id":  id,
+			}
+			for key, value := range want {
+				if record[key] != value {
+					t.Errorf("record[%q] = %v, want %v", key, record[key], value)
+				}
+			}
+			if duration, ok := record["duration_ms"].(float64); !ok || duration < 0 {
+				t.Errorf("record[duration_ms] = %v, want a non-negative number", record["duration_ms"])
+			}
+			if bytes.Contains(buf.Bytes(), []byte("secret")) {
+				t.Errorf("record logs the query string: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestRequestIDResponseKeepsClientID(t *testing.T) {
+	handler := middleware.RequestID(RequestIDResponse(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "client-id" {
+			t.Errorf("request ID = %q, want %q", id, "client-id")
+		}
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(middleware.RequestIDHeader, "client-id")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if id := rec.Header().Get(RequestIDHeader); id != "client-id" {
+		t.Errorf("%s = %q, want %q", RequestIDHeader, id, "client-id")
+	}
+}
@@ -0,0 +1,77 @@
+// Package metrics defines the service metrics, registered with the default Prometheus registry.
+// Metrics are always recorded, the /metrics endpoint is only mounted when enabled in the configuration.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Buckets of the histograms
+var (
+	durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+	countBuckets    = []float64{1, 2, 3, 5, 10, 20, 50, 100}
+)
+
+// Upload metrics, recorded by the upload handler
+var (
+	Uploads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "imgtopdf_uploads_total",
+		Help: "Upload requests by result: success, rejected or failed.",
+	}, []string{"result"})
+	UploadFiles = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "imgtopdf_upload_files",
+		Help:    "Files per upload request after ZIP archives are expanded.",
+		Buckets: countBuckets,
+	})
+	UploadBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "imgtopdf_upload_bytes_total",
+		Help: "Bytes of uploaded files that passed validation.",
+	})
+	ValidationRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "imgtopdf_validation_rejections_total",
+		Help: "Uploaded files rejected by validation, by reason.",
+	}, []string{"reason"})
+)
+
+// Conversion metrics, recorded by the PDF service
+var (
+	ConversionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "imgtopdf_conversion_duration_seconds",
+		Help:    "Duration of conversions by output format and result.",
+		Buckets: durationBuckets,
+	}, []string{"format", "result"})
+	OutputBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "imgtopdf_output_bytes_total",
+		Help: "Bytes of generated documents by output format.",
+	}, []string{"format"})
+	ImageEmbedFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "imgtopdf_image_embed_failures_total",
+		Help: "Images that could not be embedded in a document and were skipped.",
+	})
+)
+
+// Download metrics, recorded by the download handler
+var (
+	Downloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "imgtopdf_downloads_total",
+		Help: "Download requests by HTTP status code.",
+	}, []string{"code"})
+	DownloadBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "imgtopdf_download_bytes_total",
+		Help: "Bytes of downloaded files.",
+	})
+)
+
+// Validation rejection reasons
+const (
+	RejectNoFiles         = "no_files"
+	RejectTooManyFiles    = "too_many_files"
+	RejectTooLarge        = "too_large"
+	RejectUnsupportedType = "unsupported_type"
+	RejectInvalidPDF      = "invalid_pdf"
+	RejectInvalidArchive  = "invalid_archive"
+	RejectInvalidImage    = "invalid_image"
+	RejectImageDimensions = "image_dimensions"
+	RejectTooManyPixels   = "too_many_pixels"
+)
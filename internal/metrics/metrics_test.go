@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestMetricsExposed(t *testing.T) {
+	Uploads.WithLabelValues("success").Inc()
+	UploadBytes.Add(1024)
+	ConversionDuration.WithLabelValues("pdf", "success").Observe(0.3)
+	ValidationRejections.WithLabelValues(RejectTooLarge).Inc()
+
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+
+	for _, want := range []string{
+		"# TYPE imgtopdf_uploads_total counter",
+		`imgtopdf_uploads_total{result="success"} 1`,
+		"imgtopdf_upload_bytes_total 1024",
+		`imgtopdf_conversion_duration_seconds_bucket{format="pdf",result="success",le="0.5"} 1`,
+		`imgtopdf_validation_rejections_total{reason="too_large"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output is missing %q", want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
-import "mime/multipart"
+import (
+	"mime/multipart"
+	"time"
+)
 
 // UploadRequest represents the incoming file upload request
 type UploadRequest struct {
@@ -9,23 +12,63 @@ type UploadRequest struct {
 
 // UploadResponse represents the response after successful upload and conversion
 type UploadResponse struct {
-	Success bool   `json:"success"`
-	PDFFile string `json:"pdfFile"`
-	Message string `json:"message,omitempty"`
+	Success     bool       `json:"success"`
+	PDFFile     string     `json:"pdfFile"` // Output filename, also for TIFF and ZIP outputs
+	Format      string     `json:"format,omitempty"`
+	DownloadURL string     `json:"downloadUrl,omitempty"` // Signed URL of the output
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`   // When the output is deleted, unset if it is kept
+	Message     string     `json:"message,omitempty"`
+}
+
+// BatchDocument describes one generated document of a batch upload
+type BatchDocument struct {
+	Group       string `json:"group"`
+	PDFFile     string `json:"pdfFile"`
+	Format      string `json:"format"`
+	DownloadURL string `json:"downloadUrl,omitempty"`
+}
+
+// BatchUploadResponse represents the response after a batch upload and conversion
+type BatchUploadResponse struct {
+	Success   bool            `json:"success"`
+	Documents []BatchDocument `json:"documents"`
+	ZipFile   string          `json:"zipFile,omitempty"`
+	ZipURL    string          `json:"zipUrl,omitempty"`
+	ExpiresAt *time.Time      `json:"expiresAt,omitempty"`
+	Message   string          `json:"message,omitempty"`
+}
+
+// PDFToImagesResponse represents the response after converting a PDF to images
+type PDFToImagesResponse struct {
+	Success   bool       `json:"success"`
+	ZipFile   string     `json:"zipFile,omitempty"`
+	ZipURL    string     `json:"zipUrl,omitempty"`
+	Images    []string   `json:"images,omitempty"`
+	ImageURLs []string   `json:"imageUrls,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Message   string     `json:"message,omitempty"`
 }
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
-	Code    int    `json:"code,omitempty"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error"`
+	Code      int    `json:"code,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"` // Machine-readable cause, e.g. too_many_pixels for a rejected upload
 }
 
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Status  string `json:"status"`
+	Status  string                 `json:"status"`
+	Message string                 `json:"message"`
+	Version string                 `json:"version,omitempty"`
+	Checks  map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck represents the result of a single readiness check
+type HealthCheck struct {
+	Status  string `json:"status"` // ok or failed
 	Message string `json:"message"`
-	Version string `json:"version,omitempty"`
 }
 
 // ImageFile represents a processed image file
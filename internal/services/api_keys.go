@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"img-to-pdf-converter/internal/config"
+)
+
+// Errors returned when an API key can't be used
+var (
+	ErrAPIKeyMissing     = errors.New("API key required")
+	ErrAPIKeyInvalid     = errors.New("invalid API key")
+	ErrAPIKeyDisabled    = errors.New("API key is disabled")
+	ErrQuotaExceeded     = errors.New("daily quota exceeded")
+	ErrPageLimitExceeded = errors.New("page limit exceeded")
+)
+
+// APIKey is a client key with its limits. Zero limits are unlimited.
+type APIKey struct {
+	Name             string `json:"name"`
+	Key              string `json:"key"`
+	DailyConversions int    `json:"dailyConversions"`
+	DailyBytes       int64  `json:"dailyBytes"`
+	MaxPages         int    `json:"maxPages"`
+	Disabled         bool   `json:"disabled"`
+}
+
+// Usage is what a key has used on one day
+type Usage struct {
+	Conversions int
+	Bytes       int64
+}
+
+// UsageStore keeps the usage counters of API keys per UTC day, e.g. "2006-01-02"
+type UsageStore interface {
+	Get(ctx context.Context, key, day string) (Usage, error)
+	// Add adds usage to the counters without checking limits, negative values take usage back
+	Add(ctx context.Context, key, day string, usage Usage) error
+	// Reserve adds usage to the counters unless that would take a counter with a non-zero limit
+	// over it, in which case it returns ErrQuotaExceeded and changes nothing. The check and the
+	// update are atomic, so concurrent requests can't both take the last of a quota.
+	Reserve(ctx context.Context, key, day string, usage, limits Usage) error
+}
+
+// UsageReservation is the usage reserved for a request of an API key. It is settled with the
+// bytes the request actually used once it succeeds, or refunded when it fails.
+type UsageReservation struct {
+	store    UsageStore
+	key      *APIKey
+	day      string
+	reserved Usage
+}
+
+// usageReservationContextKey is the context key of the usage reservation of a request
+type usageReservationContextKey struct{}
+
+// APIKeyService looks up API keys and tracks their daily usage
+type APIKeyService struct {
+	config *config.Config
+	keys   map[[sha256.Size]byte]*APIKey
+	usage  UsageStore
+}
+
+// apiKeyContextKey is the context key of the authenticated API key
+type apiKeyContextKey struct{}
+
+// NewAPIKeyService loads the keys from the configured file and the API_KEYS variable.
+// Keys without limits of their own get the configured default limits.
+func NewAPIKeyService(cfg *config.Config, usage UsageStore) (*APIKeyService, error) {
+	var keys []*APIKey
+
+	if cfg.Auth.KeysFile != "" {
+		data, err := os.ReadFile(cfg.Auth.KeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API keys file: %v", err)
+		}
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, fmt.Errorf("invalid API keys file %s: %v", cfg.Auth.KeysFile, err)
+		}
+	}
+
+	for _, entry := range cfg.Auth.Keys {
+		name, key, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid API_KEYS entry, expected name:key pairs")
+		}
+		keys = append(keys, &APIKey{Name: name, Key: key})
+	}
+
+	s := &APIKeyService{
+		config: cfg,
+		keys:   make(map[[sha256.Size]byte]*APIKey, len(keys)),
+		usage:  usage,
+	}
+	for _, key := range keys {
+		if key.Name == "" || key.Key == "" {
+			return nil, fmt.Errorf("API keys need a name and a key")
+		}
+		if key.DailyConversions == 0 {
+			key.DailyConversions = cfg.Auth.DefaultDailyConversions
+		}
+		if key.DailyBytes == 0 {
+			key.DailyBytes = cfg.Auth.DefaultDailyBytes
+		}
+		if key.MaxPages == 0 {
+			key.MaxPages = cfg.Auth.DefaultMaxPages
+		}
+
+		hash := sha256.Sum256([]byte(key.Key))
+		if _, exists := s.keys[hash]; exists {
+			return nil, fmt.Errorf("duplicate API key %s", key.Name)
+		}
+		s.keys[hash] = key
+	}
+
+	if s.Enabled() {
+		slog.Info("API key authentication enabled", "keys", len(s.keys))
+	}
+	return s, nil
+}
+
+// Enabled reports whether any key is configured. Without keys the API is open.
+func (s *APIKeyService) Enabled() bool {
+	return len(s.keys) > 0
+}
+
+// Authenticate returns the key matching the secret sent by a client
+func (s *APIKeyService) Authenticate(secret string) (*APIKey, error) {
+	if secret == "" {
+		return nil, ErrAPIKeyMissing
+	}
+	// Keys are looked up by hash, so the lookup time doesn't depend on how much of a key matches
+	key, ok := s.keys[sha256.Sum256([]byte(secret))]
+	if !ok {
+		return nil, ErrAPIKeyInvalid
+	}
+	if key.Disabled {
+		return nil, ErrAPIKeyDisabled
+	}
+	return key, nil
+}
+
+// Reserve reserves a conversion of requestBytes for the key. It returns ErrQuotaExceeded when the
+// key has no conversions left today or when the request would go over its daily bytes.
+func (s *APIKeyService) Reserve(ctx context.Context, key *APIKey, requestBytes int64) (*UsageReservation, error) {
+	reservation := &UsageReservation{store: s.usage, key: key, day: usageDay(time.Now())}
+	if err := reservation.Add(ctx, Usage{Conversions: 1, Bytes: requestBytes}); err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// Add reserves more usage for the request, e.g. a conversion for every further output document
+func (r *UsageReservation) Add(ctx context.Context, usage Usage) error {
+	limits := Usage{Conversions: r.key.DailyConversions, Bytes: r.key.DailyBytes}
+	if err := r.store.Reserve(ctx, r.key.Name, r.day, usage, limits); err != nil {
+		if errors.Is(err, ErrQuotaExceeded) {
+			return err
+		}
+		return fmt.Errorf("failed to reserve usage: %v", err)
+	}
+	r.reserved.Conversions += usage.Conversions
+	r.reserved.Bytes += usage.Bytes
+	return nil
+}
+
+// Settle replaces the reserved bytes with the bytes the request actually read
+func (r *UsageReservation) Settle(ctx context.Context, bytes int64) error {
+	if bytes == r.reserved.Bytes {
+		return nil
+	}
+	if err := r.store.Add(ctx, r.key.Name, r.day, Usage{Bytes: bytes - r.reserved.Bytes}); err != nil {
+		return fmt.Errorf("failed to record usage: %v", err)
+	}
+	r.reserved.Bytes = bytes
+	return nil
+}
+
+// Refund gives back everything reserved for the request
+func (r *UsageReservation) Refund(ctx context.Context) error {
+	if err := r.store.Add(ctx, r.key.Name, r.day, Usage{Conversions: -r.reserved.Conversions, Bytes: -r.reserved.Bytes}); err != nil {
+		return fmt.Errorf("failed to refund usage: %v", err)
+	}
+	r.reserved = Usage{}
+	return nil
+}
+
+// WithUsageReservation returns a context carrying the usage reservation of a request
+func WithUsageReservation(ctx context.Context, reservation *UsageReservation) context.Context {
+	return context.WithValue(ctx, usageReservationContextKey{}, reservation)
+}
+
+// UsageReservationFromContext returns the usage reservation of a request, or nil when authentication is off
+func UsageReservationFromContext(ctx context.Context) *UsageReservation {
+	reservation, _ := ctx.Value(usageReservationContextKey{}).(*UsageReservation)
+	return reservation
+}
+
+// WithAPIKey returns a context carrying the authenticated key
+func WithAPIKey(ctx context.Context, key *APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// APIKeyFromContext returns the authenticated key of a request, or nil when authentication is off
+func APIKeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
+
+// maxPagesFromContext returns the page limit of the authenticated key, zero when unlimited
+func maxPagesFromContext(ctx context.Context) int {
+	if key := APIKeyFromContext(ctx); key != nil {
+		return key.MaxPages
+	}
+	return 0
+}
+
+// usageDay returns the UTC day that usage at t is counted on
+func usageDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
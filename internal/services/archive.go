@@ -0,0 +1,189 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"img-to-pdf-converter/internal/utils"
+)
+
+// zipContentTypes are the MIME types browsers use for ZIP archives
+var zipContentTypes = []string{"application/zip", "application/x-zip-compressed"}
+
+// archiveBudget tracks the limits shared by all archives of one upload
+type archiveBudget struct {
+	entries int
+	bytes   int64
+}
+
+// IsZipContentType checks if the content type denotes a ZIP archive
+func IsZipContentType(contentType string) bool {
+	for _, zipType := range zipContentTypes {
+		if contentType == zipType {
+			return true
+		}
+	}
+	return false
+}
+
+// expandArchives replaces every uploaded ZIP archive with the files it contains, in natural filename order.
+// Other files keep their position in the upload list.
+func (s *FileService) expandArchives(files []ImageInput) ([]ImageInput, error) {
+	budget := &archiveBudget{}
+	var expanded []ImageInput
+	for _, file := range files {
+		if !IsZipContentType(file.ContentType()) {
+			expanded = append(expanded, file)
+			continue
+		}
+
+		if file.Size() > s.config.Upload.MaxArchiveSize {
+			return nil, fmt.Errorf("archive %s is too large: %d bytes (max: %d bytes)",
+				file.Name(), file.Size(), s.config.Upload.MaxArchiveSize)
+		}
+
+		// Archives need random access, so read them into memory (bounded by the size check above)
+		src, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open archive %s: %v", file.Name(), err)
+		}
+		data, err := io.ReadAll(io.LimitReader(src, s.config.Upload.MaxArchiveSize+1))
+		src.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive %s: %v", file.Name(), err)
+		}
+
+		entries, err := s.readArchive(file.Name(), bytes.NewReader(data), int64(len(data)), 1, budget)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("archive %s contains no files", file.Name())
+		}
+		expanded = append(expanded, entries...)
+	}
+
+	return expanded, nil
+}
+
+// readArchive extracts the files of a ZIP archive, descending into nested archives up to the configured depth
+func (s *FileService) readArchive(archiveName string, r io.ReaderAt, size int64, depth int, budget *archiveBudget) ([]ImageInput, error) {
+	if depth > s.config.Upload.MaxArchiveDepth {
+		return nil, fmt.Errorf("archive %s is nested too deeply (max depth: %d)", archiveName, s.config.Upload.MaxArchiveDepth)
+	}
+
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("archive %s is not a valid ZIP file: %v", archiveName, err)
+	}
+
+	// Entries are processed in natural filename order, so "scan2" comes before "scan10"
+	zipFiles := make([]*zip.File, 0, len(reader.File))
+	for _, zf := range reader.File {
+		if zf.FileInfo().IsDir() || isArchiveMetadata(zf.Name) {
+			continue
+		}
+		if err := validateArchivePath(zf.Name); err != nil {
+			return nil, fmt.Errorf("archive %s: %v", archiveName, err)
+		}
+		zipFiles = append(zipFiles, zf)
+	}
+	sort.SliceStable(zipFiles, func(i, j int) bool {
+		return utils.NaturalLess(zipFiles[i].Name, zipFiles[j].Name)
+	})
+
+	var entries []ImageInput
+	for _, zf := range zipFiles {
+		budget.entries++
+		if budget.entries > s.config.Upload.MaxArchiveEntries {
+			return nil, fmt.Errorf("archive %s has too many entries (max: %d)", archiveName, s.config.Upload.MaxArchiveEntries)
+		}
+
+		data, err := s.readArchiveEntry(zf, budget)
+		if err != nil {
+			return nil, fmt.Errorf("archive %s: %v", archiveName, err)
+		}
+
+		contentType := http.DetectContentType(data)
+		if IsZipContentType(contentType) {
+			nested, err := s.readArchive(path.Base(zf.Name), bytes.NewReader(data), int64(len(data)), depth+1, budget)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, nested...)
+			continue
+		}
+
+		entries = append(entries, NewMemoryInput(utils.SanitizeFilename(zf.Name), contentType, data))
+	}
+
+	return entries, nil
+}
+
+// readArchiveEntry decompresses a single entry while enforcing the per-file and total size limits.
+// The sizes declared in the archive are not trusted, the limits are applied to the bytes actually read.
+func (s *FileService) readArchiveEntry(zf *zip.File, budget *archiveBudget) ([]byte, error) {
+	// The type of an entry is only known once it is read, the per-type limit is checked by ValidateFile
+	limit := s.config.Upload.LargestFileSize()
+	if remaining := s.config.Upload.MaxArchiveSize - budget.bytes; remaining < limit {
+		limit = remaining
+	}
+	if zf.UncompressedSize64 > uint64(limit) {
+		return nil, s.entrySizeError(zf.Name, budget)
+	}
+
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", zf.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", zf.Name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, s.entrySizeError(zf.Name, budget)
+	}
+
+	budget.bytes += int64(len(data))
+	return data, nil
+}
+
+// entrySizeError reports which size limit an archive entry exceeds
+func (s *FileService) entrySizeError(name string, budget *archiveBudget) error {
+	maxSize := s.config.Upload.LargestFileSize()
+	if s.config.Upload.MaxArchiveSize-budget.bytes < maxSize {
+		return fmt.Errorf("decompressed size exceeds the limit of %d bytes", s.config.Upload.MaxArchiveSize)
+	}
+	return fmt.Errorf("file %s is too large (max: %d bytes)", name, maxSize)
+}
+
+// validateArchivePath rejects entry names that would escape the extraction directory (zip slip)
+func validateArchivePath(name string) error {
+	normalized := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(normalized, "/") || strings.Contains(normalized, ":") {
+		return fmt.Errorf("entry %s has an absolute path", name)
+	}
+	for _, part := range strings.Split(normalized, "/") {
+		if part == ".." {
+			return fmt.Errorf("entry %s escapes the archive", name)
+		}
+	}
+	return nil
+}
+
+// isArchiveMetadata checks for files that archivers add next to the actual content
+func isArchiveMetadata(name string) bool {
+	if strings.HasPrefix(name, "__MACOSX/") {
+		return true
+	}
+	base := path.Base(name)
+	return strings.HasPrefix(base, ".") || base == "Thumbs.db" || base == "desktop.ini"
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// zipFile is an entry of a test archive
+type zipFile struct {
+	name string
+	data []byte
+}
+
+// testZip returns a ZIP archive holding the given entries in order
+func testZip(t *testing.T, files ...zipFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", file.name, err)
+		}
+		if _, err := w.Write(file.data); err != nil {
+			t.Fatalf("failed to write %s: %v", file.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExpandArchives(t *testing.T) {
+	image := testPNG(t, 4, 4)
+	nested := func(depth int) []byte {
+		data := testZip(t, zipFile{"deep.png", image})
+		for i := 1; i < depth; i++ {
+			data = testZip(t, zipFile{"inner.zip", data})
+		}
+		return data
+	}
+
+	tests := []struct {
+		name       string
+		archive    []byte
+		maxEntries int
+		maxSize    int64
+		want       []string
+		wantErr    string
+	}{
+		{
+			name:    "natural order",
+			archive: testZip(t, zipFile{"scan10.png", image}, zipFile{"scan2.png", image}, zipFile{"Scan1.png", image}, zipFile{"scan02.png", image}),
+			want:    []string{"Scan1.png", "scan2.png", "scan02.png", "scan10.png"},
+		},
+		{
+			name: "metadata skipped",
+			archive: testZip(t, zipFile{"__MACOSX/._page.png", image}, zipFile{"pages/.DS_Store", []byte("x")},
+				zipFile{"Thumbs.db", []byte("x")}, zipFile{"desktop.ini", []byte("x")}, zipFile{"pages/page.png", image}),
+			want: []string{"page.png"},
+		},
+		{
+			name:    "only metadata",
+			archive: testZip(t, zipFile{"__MACOSX/._page.png", image}, zipFile{".hidden.png", image}),
+			wantErr: "contains no files",
+		},
+		{name: "parent directory", archive: testZip(t, zipFile{"../evil.png", image}), wantErr: "escapes the archive"},
+		{name: "nested parent directory", archive: testZip(t, zipFile{"pages/../../evil.png", image}), wantErr: "escapes the archive"},
+		{name: "backslash parent directory", archive: testZip(t, zipFile{"pages\\..\\..\\evil.png", image}), wantErr: "escapes the archive"},
+		{name: "absolute path", archive: testZip(t, zipFile{"/etc/evil.png", image}), wantErr: "absolute path"},
+		{name: "drive letter", archive: testZip(t, zipFile{"C:\\evil.png", image}), wantErr: "absolute path"},
+		{
+			name:       "entry budget",
+			archive:    testZip(t, zipFile{"a.png", image}, zipFile{"b.png", image}, zipFile{"c.png", image}),
+			maxEntries: 2,
+			wantErr:    "too many entries (max: 2)",
+		},
+		{
+			// Compressed the archive is well within the limit, decompressed it is not
+			name:    "byte budget",
+			archive: testZip(t, zipFile{"a.bin", make([]byte, 4000)}, zipFile{"b.bin", make([]byte, 4000)}),
+			maxSize: 6000,
+			wantErr: "decompressed size exceeds the limit of 6000 bytes",
+		},
+		{name: "nested within depth", archive: nested(2), want: []string{"deep.png"}},
+		{name: "nested too deeply", archive: nested(3), wantErr: "nested too deeply (max depth: 2)"},
+		{name: "not a ZIP file", archive: []byte("PK\x03\x04 truncated"), wantErr: "not a valid ZIP file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			if tt.maxEntries > 0 {
+				cfg.Upload.MaxArchiveEntries = tt.maxEntries
+			}
+			if tt.maxSize > 0 {
+				cfg.Upload.MaxArchiveSize = tt.maxSize
+			}
+			s := NewFileService(cfg)
+
+			files, err := s.expandArchives([]ImageInput{NewMemoryInput("upload.zip", "application/zip", tt.archive)})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expandArchives() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandArchives() error = %v", err)
+			}
+			var names []string
+			for _, file := range files {
+				names = append(names, file.Name())
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expandArchives() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandArchivesSharesBudget(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Upload.MaxArchiveEntries = 3
+	s := NewFileService(cfg)
+
+	image := testPNG(t, 4, 4)
+	archive := testZip(t, zipFile{"a.png", image}, zipFile{"b.png", image})
+	files := []ImageInput{
+		NewMemoryInput("first.zip", "application/zip", archive),
+		NewMemoryInput("loose.png", "image/png", image),
+		NewMemoryInput("second.zip", "application/zip", archive),
+	}
+
+	// Four entries over two archives exceed a limit each archive stays within on its own
+	if _, err := s.expandArchives(files); err == nil || !strings.Contains(err.Error(), "archive second.zip has too many entries") {
+		t.Errorf("expandArchives() error = %v, want the entry limit for the second archive", err)
+	}
+}
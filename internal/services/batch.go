@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+)
+
+// BatchGroup is a set of uploaded files converted into one document
+type BatchGroup struct {
+	Name    string
+	Files   []ImageInput
+	Options ConversionOptions
+}
+
+// BatchResult holds the generated document of a batch group
+type BatchResult struct {
+	Name       string
+	OutputName string // Name of the document in storage
+}
+
+// ConvertBatch converts every group into its own document, in group order.
+// When bundle is set the documents are also packed into a ZIP archive whose name is returned.
+// If any group fails or ctx is cancelled, the documents already generated for the batch are removed.
+func (s *PDFService) ConvertBatch(ctx context.Context, groups []BatchGroup, bundle bool) ([]BatchResult, string, error) {
+	if len(groups) == 0 {
+		return nil, "", fmt.Errorf("no groups provided")
+	}
+
+	var results []BatchResult
+	cleanup := func() {
+		for _, result := range results {
+			s.removeOutput(ctx, result.OutputName)
+		}
+	}
+
+	for _, group := range groups {
+		outputName, err := s.ConvertImagesToPDFWithOptions(ctx, group.Files, group.Options)
+		if err != nil {
+			cleanup()
+			if errors.Is(err, ErrConversionTimeout) || errors.Is(err, context.Canceled) || errors.Is(err, ErrPageLimitExceeded) {
+				return nil, "", err
+			}
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				return nil, "", fmt.Errorf("group %s: %w", group.Name, err)
+			}
+			return nil, "", fmt.Errorf("group %s: %v", group.Name, err)
+		}
+		slog.InfoContext(ctx, "Batch group converted", "group", group.Name, "output", outputName)
+		results = append(results, BatchResult{Name: group.Name, OutputName: outputName})
+	}
+
+	if !bundle {
+		return results, "", nil
+	}
+
+	// Name the archive entries after their groups so customers are easy to tell apart
+	entries := make([]zipEntry, 0, len(results))
+	for _, result := range results {
+		entries = append(entries, s.storedZipEntry(ctx, result.Name+filepath.Ext(result.OutputName), result.OutputName))
+	}
+
+	zipName := s.newOutputName("converted_batch", "zip")
+	err := s.saveOutput(ctx, zipName, func(w io.Writer) error {
+		return writeZip(w, entries)
+	})
+	if err != nil {
+		cleanup()
+		if ctxErr := conversionContextError(ctx); ctxErr != nil {
+			return nil, "", ctxErr
+		}
+		return nil, "", fmt.Errorf("failed to create ZIP archive: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Batch ZIP archive saved", "output", zipName, "documents", len(results))
+	return results, zipName, nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingBundleStorage lets the group documents be stored, then holds back their content when
+// the bundle reads them until the context ends, as a slow backend would
+type blockingBundleStorage struct {
+	*MemoryStorage
+	onGet func()
+}
+
+func (s *blockingBundleStorage) Get(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	s.onGet()
+	<-ctx.Done()
+	return nil, ObjectInfo{}, ctx.Err()
+}
+
+func TestConvertBatchBundleContextEnds(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+		want    error
+	}{
+		{name: "request cancelled", cancel: true, want: context.Canceled},
+		{name: "deadline passed", timeout: 100 * time.Millisecond, want: ErrConversionTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.timeout > 0 {
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			storage := &blockingBundleStorage{MemoryStorage: NewMemoryStorage(), onGet: func() {
+				if tt.cancel {
+					cancel()
+				}
+			}}
+			s := NewPDFService(testConfig(t), storage)
+			groups := []BatchGroup{
+				{Name: "a", Files: []ImageInput{NewMemoryInput("a.png", "image/png", testPNG(t, 20, 10))}},
+				{Name: "b", Files: []ImageInput{NewMemoryInput("b.png", "image/png", testPNG(t, 10, 20))}},
+			}
+
+			results, zipName, err := s.ConvertBatch(ctx, groups, true)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ConvertBatch() error = %v, want %v", err, tt.want)
+			}
+			if results != nil || zipName != "" {
+				t.Errorf("ConvertBatch() = %v, %q, want no results", results, zipName)
+			}
+
+			// The documents of the groups are removed along with the unfinished archive
+			objects, err := storage.List(context.Background(), "")
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if len(objects) != 0 {
+				var names []string
+				for _, object := range objects {
+					names = append(names, object.Name)
+				}
+				t.Errorf("objects left in storage: %s", strings.Join(names, ", "))
+			}
+		})
+	}
+}
+
+func TestWriteZipKeepsCause(t *testing.T) {
+	entries := []zipEntry{{
+		Name: "page.png",
+		Open: func() (io.ReadCloser, error) { return nil, context.Canceled },
+	}}
+	if err := writeZip(io.Discard, entries); !errors.Is(err, context.Canceled) {
+		t.Errorf("writeZip() error = %v, want it to wrap context.Canceled", err)
+	}
+}
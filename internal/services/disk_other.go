@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package services
+
+// freeDiskSpace is not supported on this platform, the disk check is skipped
+func freeDiskSpace(path string) (int64, error) {
+	return 0, errDiskSpaceUnsupported
+}
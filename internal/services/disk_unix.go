@@ -0,0 +1,14 @@
+//go:build linux || darwin
+
+package services
+
+import "syscall"
+
+// freeDiskSpace returns the bytes available to unprivileged users on the filesystem holding path
+func freeDiskSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"img-to-pdf-converter/internal/config"
+)
+
+// Errors returned when a download link doesn't verify
+var (
+	ErrInvalidSignature = errors.New("invalid download signature")
+	ErrLinkExpired      = errors.New("download link has expired")
+)
+
+// DownloadLink is a verified download request
+type DownloadLink struct {
+	File    string
+	Expires time.Time
+	Once    bool // The first download removes the file
+}
+
+// DownloadSigner creates and verifies download links signed with HMAC-SHA256
+// over the filename, the expiry and the one-time flag
+type DownloadSigner struct {
+	config *config.Config
+	secret []byte
+}
+
+// NewDownloadSigner creates a signer with the configured secret. Without a secret a random one is
+// generated, so links only verify on the instance that issued them until the service restarts.
+func NewDownloadSigner(cfg *config.Config) *DownloadSigner {
+	secret := []byte(cfg.Download.SigningSecret)
+	if len(secret) == 0 {
+		slog.Warn("DOWNLOAD_SIGNING_SECRET is not set, download links are only valid on this instance")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+
+	return &DownloadSigner{
+		config: cfg,
+		secret: secret,
+	}
+}
+
+// SignedURL returns the download URL of file, valid for the link TTL but never beyond the output TTL
+func (s *DownloadSigner) SignedURL(file string, once bool) string {
+	ttl := s.config.Download.LinkTTL
+	if outputTTL := s.config.Janitor.OutputTTL; outputTTL > 0 && (ttl <= 0 || outputTTL < ttl) {
+		ttl = outputTTL
+	}
+	expires := time.Now().Add(ttl).Unix()
+
+	query := url.Values{}
+	query.Set("file", file)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	if once {
+		query.Set("once", "true")
+	}
+	query.Set("sig", s.signature(file, expires, once))
+
+	return "/download?" + query.Encode()
+}
+
+// Verify checks the signature and expiry of a download request
+func (s *DownloadSigner) Verify(query url.Values) (DownloadLink, error) {
+	file := query.Get("file")
+	once := query.Get("once") == "true"
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return DownloadLink{}, ErrInvalidSignature
+	}
+
+	expected := s.signature(file, expires, once)
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(expected)) {
+		return DownloadLink{}, ErrInvalidSignature
+	}
+
+	link := DownloadLink{File: file, Expires: time.Unix(expires, 0), Once: once}
+	if time.Now().After(link.Expires) {
+		return DownloadLink{}, ErrLinkExpired
+	}
+	return link, nil
+}
+
+// signature computes the URL-safe HMAC of the link fields
+func (s *DownloadSigner) signature(file string, expires int64, once bool) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(file + "\n" + strconv.FormatInt(expires, 10) + "\n" + strconv.FormatBool(once)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
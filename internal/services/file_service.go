@@ -1,61 +1,192 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"mime/multipart"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"img-to-pdf-converter/internal/config"
+	"img-to-pdf-converter/internal/metrics"
+	"img-to-pdf-converter/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
 )
 
+// PDFContentType is the MIME type of PDF documents that are merged into the output
+const PDFContentType = "application/pdf"
+
+// pdfSignature is the magic header every PDF document starts with
+var pdfSignature = []byte("%PDF-")
+
 // FileService handles file operations
 type FileService struct {
-	config *config.Config
+	config     *config.Config
+	httpClient *http.Client
 }
 
 // NewFileService creates a new file service instance
 func NewFileService(cfg *config.Config) *FileService {
 	return &FileService{
-		config: cfg,
+		config:     cfg,
+		httpClient: newFetchClient(cfg),
 	}
 }
 
 // ValidateFile validates an uploaded file
-func (s *FileService) ValidateFile(fileHeader *multipart.FileHeader) error {
-	// Check file size
-	if fileHeader.Size > s.config.Upload.MaxFileSize {
-		return fmt.Errorf("file %s is too large: %d bytes (max: %d bytes)",
-			fileHeader.Filename, fileHeader.Size, s.config.Upload.MaxFileSize)
+func (s *FileService) ValidateFile(file ImageInput) error {
+	contentType := file.ContentType()
+
+	// Check file size, some types may have a limit of their own
+	if maxSize := s.config.Upload.MaxSizeFor(contentType); file.Size() > maxSize {
+		return reject(metrics.RejectTooLarge, fmt.Errorf("file %s is too large: %d bytes (max: %d bytes)",
+			file.Name(), file.Size(), maxSize))
 	}
 
 	// Check file type
-	contentType := fileHeader.Header.Get("Content-Type")
 	if !s.isAllowedType(contentType) {
-		return fmt.Errorf("file %s has unsupported type: %s", fileHeader.Filename, contentType)
+		return reject(metrics.RejectUnsupportedType, fmt.Errorf("file %s has unsupported type: %s", file.Name(), contentType))
+	}
+
+	// PDFs are imported page by page, so make sure the content really is one
+	if contentType == PDFContentType {
+		if err := s.validatePDFHeader(file); err != nil {
+			return reject(metrics.RejectInvalidPDF, err)
+		}
+		return nil
+	}
+
+	return s.validateImageDimensions(file)
+}
+
+// validateImageDimensions checks the dimensions an image declares in its header against the limits,
+// without decoding the pixels. A small file can declare a huge image that would exhaust memory once
+// decoded (a decompression bomb). Images whose header can't be read are rejected, their size is unknown.
+func (s *FileService) validateImageDimensions(file ImageInput) error {
+	src, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %v", file.Name(), err)
+	}
+	defer src.Close()
+
+	imageConfig, _, err := image.DecodeConfig(src)
+	if err != nil {
+		return reject(metrics.RejectInvalidImage, fmt.Errorf("file %s is not a valid image: %v", file.Name(), err))
+	}
+
+	if imageConfig.Width > s.config.Upload.MaxImageWidth || imageConfig.Height > s.config.Upload.MaxImageHeight {
+		return reject(metrics.RejectImageDimensions, fmt.Errorf("image %s is too large: %dx%d pixels (max: %dx%d pixels)", file.Name(),
+			imageConfig.Width, imageConfig.Height, s.config.Upload.MaxImageWidth, s.config.Upload.MaxImageHeight))
+	}
+
+	megapixels := float64(imageConfig.Width) * float64(imageConfig.Height) / 1e6
+	if megapixels > s.config.Upload.MaxImageMegapixels {
+		return reject(metrics.RejectTooManyPixels, fmt.Errorf("image %s has too many pixels: %dx%d is %.1f megapixels (max: %g megapixels)",
+			file.Name(), imageConfig.Width, imageConfig.Height, megapixels, s.config.Upload.MaxImageMegapixels))
 	}
 
 	return nil
 }
 
-// ValidateFiles validates multiple uploaded files
-func (s *FileService) ValidateFiles(files []*multipart.FileHeader) error {
+// validatePDFHeader checks that an uploaded file starts with the PDF signature
+func (s *FileService) validatePDFHeader(file ImageInput) error {
+	src, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %v", file.Name(), err)
+	}
+	defer src.Close()
+
+	header := make([]byte, len(pdfSignature))
+	if _, err := io.ReadFull(src, header); err != nil || !bytes.Equal(header, pdfSignature) {
+		return fmt.Errorf("file %s is not a valid PDF document", file.Name())
+	}
+
+	return nil
+}
+
+// ValidateFiles validates multiple uploaded files and returns the files to convert.
+// ZIP archives are expanded in place, their entries count against the file limits like regular uploads.
+func (s *FileService) ValidateFiles(ctx context.Context, files []ImageInput) (_ []ImageInput, err error) {
+	_, span := tracing.Start(ctx, "FileService.ValidateFiles",
+		attribute.Int("files.count", len(files)),
+		attribute.Int64("files.bytes", totalSize(files)))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	if len(files) == 0 {
-		return fmt.Errorf("no files provided")
+		return nil, reject(metrics.RejectNoFiles, fmt.Errorf("no files provided"))
 	}
 
 	if len(files) > s.config.Upload.MaxFiles {
-		return fmt.Errorf("too many files: %d (max: %d)", len(files), s.config.Upload.MaxFiles)
+		return nil, reject(metrics.RejectTooManyFiles, fmt.Errorf("too many files: %d (max: %d)", len(files), s.config.Upload.MaxFiles))
+	}
+
+	if total := totalSize(files); total > s.config.Upload.MaxRequestSize {
+		return nil, reject(metrics.RejectTooLarge, fmt.Errorf("upload is too large: %d bytes (max: %d bytes)", total, s.config.Upload.MaxRequestSize))
 	}
 
 	for _, file := range files {
+		contentType := file.ContentType()
+		if IsZipContentType(contentType) && !s.isAllowedType(contentType) {
+			return nil, reject(metrics.RejectUnsupportedType, fmt.Errorf("file %s has unsupported type: %s", file.Name(), contentType))
+		}
+	}
+
+	expanded, err := s.expandArchives(files)
+	if err != nil {
+		return nil, reject(metrics.RejectInvalidArchive, err)
+	}
+
+	if len(expanded) > s.config.Upload.MaxFiles {
+		return nil, reject(metrics.RejectTooManyFiles, fmt.Errorf("too many files: %d (max: %d)", len(expanded), s.config.Upload.MaxFiles))
+	}
+
+	for _, file := range expanded {
 		if err := s.ValidateFile(file); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	span.SetAttributes(attribute.Int("files.expanded_count", len(expanded)))
+	return expanded, nil
+}
+
+// totalSize returns the combined size of the files in bytes
+func totalSize(files []ImageInput) int64 {
+	var total int64
+	for _, file := range files {
+		total += file.Size()
+	}
+	return total
+}
+
+// ValidationError is an upload rejected by validation. The reason tells clients the cause
+// apart from the message, it is also the label of the rejection metric.
+type ValidationError struct {
+	Reason string
+	Err    error
+}
+
+// Error returns the message of the rejection
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// reject counts a validation rejection and returns its error
+func reject(reason string, err error) error {
+	metrics.ValidationRejections.WithLabelValues(reason).Inc()
+	return &ValidationError{Reason: reason, Err: err}
 }
 
 // isAllowedType checks if the content type is allowed
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"img-to-pdf-converter/internal/config"
+)
+
+// errDiskSpaceUnsupported is returned where free disk space can't be determined
+var errDiskSpaceUnsupported = errors.New("free disk space is not supported on this platform")
+
+// healthProbeName is the name of the file written to check that a directory is writable.
+// In the output directory it looks like a partial write, so it is never listed as an output.
+const healthProbeName = ".healthcheck" + partialMarker + "*"
+
+// HealthCheck is the result of a single readiness check
+type HealthCheck struct {
+	Name    string
+	Healthy bool
+	Message string
+}
+
+// HealthChecker checks whether the instance can take conversions
+type HealthChecker struct {
+	config  *config.Config
+	storage Storage
+	limiter *ConversionLimiter
+}
+
+// NewHealthChecker creates a health checker. The limiter is optional.
+func NewHealthChecker(cfg *config.Config, storage Storage, limiter *ConversionLimiter) *HealthChecker {
+	return &HealthChecker{
+		config:  cfg,
+		storage: storage,
+		limiter: limiter,
+	}
+}
+
+// Check runs every readiness check and returns the results in a fixed order
+func (c *HealthChecker) Check(ctx context.Context) []HealthCheck {
+	dirs := c.directories()
+
+	checks := make([]HealthCheck, 0, len(dirs)+3)
+	for _, dir := range dirs {
+		checks = append(checks, checkDirectory(dir.name, dir.path))
+	}
+	checks = append(checks, c.checkDiskSpace(dirs), c.checkConversionQueue(), c.checkStorage(ctx))
+	return checks
+}
+
+// healthDirectory is a local directory the service writes to
+type healthDirectory struct {
+	name string
+	path string
+}
+
+// directories returns the directories to check. The output directory is only used by filesystem storage.
+func (c *HealthChecker) directories() []healthDirectory {
+	dirs := []healthDirectory{
+		{name: "temp_dir", path: c.config.Upload.TempDir},
+		{name: "upload_dir", path: c.config.Upload.UploadDir},
+	}
+	if c.config.Storage.Backend == "filesystem" || c.config.Storage.Backend == "" {
+		dirs = append(dirs, healthDirectory{name: "output_dir", path: c.config.PDF.OutputDir})
+	}
+	return dirs
+}
+
+// checkDirectory checks that a directory exists and a file can be created in it
+func checkDirectory(name, path string) HealthCheck {
+	info, err := os.Stat(path)
+	if err != nil {
+		return HealthCheck{Name: name, Message: fmt.Sprintf("%s is not accessible: %v", path, err)}
+	}
+	if !info.IsDir() {
+		return HealthCheck{Name: name, Message: fmt.Sprintf("%s is not a directory", path)}
+	}
+
+	probe, err := os.CreateTemp(path, healthProbeName)
+	if err != nil {
+		return HealthCheck{Name: name, Message: fmt.Sprintf("%s is not writable: %v", path, err)}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	return HealthCheck{Name: name, Healthy: true, Message: path + " is writable"}
+}
+
+// checkDiskSpace checks that the filesystems of the directories have enough free space
+func (c *HealthChecker) checkDiskSpace(dirs []healthDirectory) HealthCheck {
+	check := HealthCheck{Name: "disk", Healthy: true}
+
+	lowest := int64(-1)
+	for _, dir := range dirs {
+		free, err := freeDiskSpace(dir.path)
+		if errors.Is(err, errDiskSpaceUnsupported) {
+			check.Message = err.Error()
+			return check
+		}
+		if err != nil {
+			// A missing directory already fails its own check
+			continue
+		}
+		if free < c.config.Health.MinFreeDisk {
+			check.Healthy = false
+			check.Message = fmt.Sprintf("%s has %d bytes free (min: %d bytes)", dir.name, free, c.config.Health.MinFreeDisk)
+			return check
+		}
+		if lowest < 0 || free < lowest {
+			lowest = free
+		}
+	}
+
+	check.Message = fmt.Sprintf("%d bytes free (min: %d bytes)", lowest, c.config.Health.MinFreeDisk)
+	return check
+}
+
+// checkConversionQueue checks that not too many requests are waiting for a conversion slot
+func (c *HealthChecker) checkConversionQueue() HealthCheck {
+	if c.limiter == nil {
+		return HealthCheck{Name: "conversion_queue", Healthy: true, Message: "concurrent conversions are unlimited"}
+	}
+
+	inFlight, waiting := c.limiter.InFlight(), c.limiter.Waiting()
+	message := fmt.Sprintf("%d of %d conversion slots in use, %d requests waiting", inFlight, c.limiter.Capacity(), waiting)
+	if max := c.config.Health.MaxQueuedConversions; max > 0 && waiting >= max {
+		return HealthCheck{Name: "conversion_queue", Message: message + fmt.Sprintf(" (max: %d)", max)}
+	}
+	return HealthCheck{Name: "conversion_queue", Healthy: true, Message: message}
+}
+
+// checkStorage checks that the storage backend answers. Looking up an object that doesn't
+// exist is enough, it needs working credentials without writing anything.
+func (c *HealthChecker) checkStorage(ctx context.Context) HealthCheck {
+	if c.config.Health.CheckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Health.CheckTimeout)
+		defer cancel()
+	}
+
+	backend := c.config.Storage.Backend
+	if backend == "" {
+		backend = "filesystem"
+	}
+
+	_, err := c.storage.Stat(ctx, "healthcheck")
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return HealthCheck{Name: "storage", Message: fmt.Sprintf("%s storage is unreachable: %v", backend, err)}
+	}
+	return HealthCheck{Name: "storage", Healthy: true, Message: backend + " storage is reachable"}
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"img-to-pdf-converter/internal/config"
+)
+
+// statStorage is a storage whose Stat returns err, as an unreachable backend would
+type statStorage struct {
+	*MemoryStorage
+	err error
+}
+
+func (s *statStorage) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	return ObjectInfo{}, s.err
+}
+
+// blockingStatStorage is a storage whose Stat hangs until the context ends
+type blockingStatStorage struct {
+	*MemoryStorage
+}
+
+func (s *blockingStatStorage) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	<-ctx.Done()
+	return ObjectInfo{}, ctx.Err()
+}
+
+// healthTestConfig returns a configuration whose directories all exist
+func healthTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := testConfig(t)
+	for _, dir := range []string{cfg.Upload.TempDir, cfg.Upload.UploadDir, cfg.PDF.OutputDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+// findCheck returns the check with the given name
+func findCheck(t *testing.T, checks []HealthCheck, name string) HealthCheck {
+	t.Helper()
+	for _, check := range checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	t.Fatalf("no %s check in %+v", name, checks)
+	return HealthCheck{}
+}
+
+func TestHealthCheckerHealthy(t *testing.T) {
+	cfg := healthTestConfig(t)
+	checker := NewHealthChecker(cfg, NewMemoryStorage(), NewConversionLimiter(2, time.Second))
+
+	checks := checker.Check(context.Background())
+	var names []string
+	for _, check := range checks {
+		names = append(names, check.Name)
+		if !check.Healthy {
+			t.Errorf("check %s failed: %s", check.Name, check.Message)
+		}
+	}
+	want := "temp_dir,upload_dir,output_dir,disk,conversion_queue,storage"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("checks = %s, want %s", got, want)
+	}
+
+	// Probe files are removed again
+	for _, dir := range []string{cfg.Upload.TempDir, cfg.Upload.UploadDir, cfg.PDF.OutputDir} {
+		if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+			t.Errorf("%s holds %d files after the check", dir, len(entries))
+		}
+	}
+}
+
+func TestHealthCheckerDirectories(t *testing.T) {
+	tests := []struct {
+		name        string
+		prepare     func(t *testing.T, cfg *config.Config)
+		check       string
+		wantMessage string
+	}{
+		{
+			name: "missing directory",
+			prepare: func(t *testing.T, cfg *config.Config) {
+				os.RemoveAll(cfg.Upload.UploadDir)
+			},
+			check:       "upload_dir",
+			wantMessage: "is not accessible",
+		},
+		{
+			name: "file instead of directory",
+			prepare: func(t *testing.T, cfg *config.Config) {
+				os.RemoveAll(cfg.Upload.TempDir)
+				if err := os.WriteFile(cfg.Upload.TempDir, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			check:       "temp_dir",
+			wantMessage: "is not a directory",
+		},
+		{
+			name: "unwritable directory",
+			prepare: func(t *testing.T, cfg *config.Config) {
+				if err := os.Chmod(cfg.PDF.OutputDir, 0555); err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() {
+					os.Chmod(cfg.PDF.OutputDir, 0755)
+				})
+				// Permissions don't apply to root
+				if probe, err := os.CreateTemp(cfg.PDF.OutputDir, "probe"); err == nil {
+					probe.Close()
+					os.Remove(probe.Name())
+					t.Skip("directory permissions are not enforced for this user")
+				}
+			},
+			check:       "output_dir",
+			wantMessage: "is not writable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := healthTestConfig(t)
+			tt.prepare(t, cfg)
+
+			check := findCheck(t, NewHealthChecker(cfg, NewMemoryStorage(), nil).Check(context.Background()), tt.check)
+			if check.Healthy {
+				t.Fatalf("%s check is healthy: %s", tt.check, check.Message)
+			}
+			if !strings.Contains(check.Message, tt.wantMessage) {
+				t.Errorf("message = %q, want %q", check.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestHealthCheckerOutputDirOnlyForFilesystemStorage(t *testing.T) {
+	cfg := healthTestConfig(t)
+	cfg.Storage.Backend = "s3"
+	os.RemoveAll(cfg.PDF.OutputDir)
+
+	for _, check := range NewHealthChecker(cfg, NewMemoryStorage(), nil).Check(context.Background()) {
+		if check.Name == "output_dir" {
+			t.Errorf("output_dir is checked with S3 storage: %+v", check)
+		}
+	}
+}
+
+func TestHealthCheckerLowDisk(t *testing.T) {
+	if _, err := freeDiskSpace(t.TempDir()); errors.Is(err, errDiskSpaceUnsupported) {
+		t.Skip(err)
+	}
+
+	cfg := healthTestConfig(t)
+	cfg.Health.MinFreeDisk = 1 << 62
+
+	check := findCheck(t, NewHealthChecker(cfg, NewMemoryStorage(), nil).Check(context.Background()), "disk")
+	if check.Healthy {
+		t.Fatalf("disk check is healthy: %s", check.Message)
+	}
+	if want := "temp_dir has "; !strings.HasPrefix(check.Message, want) {
+		t.Errorf("message = %q, want prefix %q", check.Message, want)
+	}
+}
+
+func TestHealthCheckerConversionQueue(t *testing.T) {
+	cfg := healthTestConfig(t)
+	cfg.Health.MaxQueuedConversions = 1
+	limiter := NewConversionLimiter(1, time.Minute)
+	checker := NewHealthChecker(cfg, NewMemoryStorage(), limiter)
+
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer limiter.Release()
+	if check := findCheck(t, checker.Check(context.Background()), "conversion_queue"); !check.Healthy {
+		t.Errorf("conversion_queue check failed with no request waiting: %s", check.Message)
+	}
+
+	// A second request waits for the only slot
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		limiter.Acquire(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	for deadline := time.Now().Add(time.Second); limiter.Waiting() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("request never started waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	check := findCheck(t, checker.Check(context.Background()), "conversion_queue")
+	if check.Healthy {
+		t.Fatalf("conversion_queue check is healthy: %s", check.Message)
+	}
+	if want := "1 of 1 conversion slots in use, 1 requests waiting (max: 1)"; check.Message != want {
+		t.Errorf("message = %q, want %q", check.Message, want)
+	}
+}
+
+func TestHealthCheckerStorage(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantHealthy bool
+	}{
+		{name: "missing object", err: ErrObjectNotFound, wantHealthy: true},
+		{name: "wrapped missing object", err: errors.Join(errors.New("head healthcheck"), ErrObjectNotFound), wantHealthy: true},
+		{name: "access denied", err: errors.New("403 Forbidden: AccessDenied")},
+		{name: "timeout", err: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := healthTestConfig(t)
+			cfg.Storage.Backend = "s3"
+			storage := &statStorage{MemoryStorage: NewMemoryStorage(), err: tt.err}
+
+			check := findCheck(t, NewHealthChecker(cfg, storage, nil).Check(context.Background()), "storage")
+			if check.Healthy != tt.wantHealthy {
+				t.Fatalf("storage check healthy = %v, want %v: %s", check.Healthy, tt.wantHealthy, check.Message)
+			}
+			if !tt.wantHealthy && !strings.Contains(check.Message, "s3 storage is unreachable: "+tt.err.Error()) {
+				t.Errorf("message = %q, want the storage error", check.Message)
+			}
+		})
+	}
+}
+
+func TestHealthCheckerStorageTimeout(t *testing.T) {
+	cfg := healthTestConfig(t)
+	cfg.Health.CheckTimeout = 20 * time.Millisecond
+	storage := &blockingStatStorage{MemoryStorage: NewMemoryStorage()}
+
+	start := time.Now()
+	check := findCheck(t, NewHealthChecker(cfg, storage, nil).Check(context.Background()), "storage")
+	if check.Healthy {
+		t.Fatalf("storage check is healthy: %s", check.Message)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("check took %v, want it bounded by the check timeout", elapsed)
+	}
+}
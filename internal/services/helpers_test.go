@@ -0,0 +1,78 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"img-to-pdf-converter/internal/config"
+	"img-to-pdf-converter/internal/tracing"
+)
+
+// testConfig returns a configuration with small limits and directories inside the test's temp dir
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	return &config.Config{
+		Upload: config.UploadConfig{
+			MaxFileSize:        1 << 20,
+			MaxTypeSizes:       map[string]int64{},
+			MaxRequestSize:     4 << 20,
+			MaxFiles:           10,
+			MaxBatchGroups:     5,
+			MaxArchiveSize:     8 << 20,
+			MaxArchiveEntries:  20,
+			MaxArchiveDepth:    2,
+			MaxImageWidth:      20000,
+			MaxImageHeight:     20000,
+			MaxImageMegapixels: 100,
+			AllowedTypes:       []string{"image/jpeg", "image/png", "image/gif", "application/pdf", "application/zip"},
+			TempDir:            dir + "/temp",
+			UploadDir:          dir + "/uploads",
+		},
+		PDF: config.PDFConfig{
+			OutputDir:        dir + "/output",
+			DefaultRasterDPI: 150,
+			MaxRasterDPI:     600,
+		},
+		Fetch: config.FetchConfig{
+			Timeout:      5 * time.Second,
+			MaxRedirects: 3,
+		},
+	}
+}
+
+// withTestTracer installs a tracer provider that keeps the spans in memory
+func withTestTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	previous := otel.GetTracerProvider()
+	tracing.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	})
+	return exporter
+}
+
+// testPNG returns an encoded PNG image of the given size
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+)
+
+// ImageInput is a file to convert, independent of how it was received
+type ImageInput interface {
+	// Name returns the original filename
+	Name() string
+	// ContentType returns the MIME type of the content
+	ContentType() string
+	// Size returns the size of the content in bytes
+	Size() int64
+	// Open returns a reader for the content, the caller must close it
+	Open() (io.ReadCloser, error)
+}
+
+// multipartInput adapts an uploaded multipart file
+type multipartInput struct {
+	header *multipart.FileHeader
+}
+
+// NewMultipartInputs wraps uploaded multipart files as conversion inputs
+func NewMultipartInputs(files []*multipart.FileHeader) []ImageInput {
+	inputs := make([]ImageInput, 0, len(files))
+	for _, file := range files {
+		inputs = append(inputs, &multipartInput{header: file})
+	}
+	return inputs
+}
+
+// Name returns the uploaded filename
+func (i *multipartInput) Name() string {
+	return i.header.Filename
+}
+
+// ContentType returns the content type sent by the client
+func (i *multipartInput) ContentType() string {
+	return i.header.Header.Get("Content-Type")
+}
+
+// Size returns the uploaded size
+func (i *multipartInput) Size() int64 {
+	return i.header.Size
+}
+
+// Open opens the uploaded file
+func (i *multipartInput) Open() (io.ReadCloser, error) {
+	return i.header.Open()
+}
+
+// MemoryInput is a file held in memory, such as an archive entry, a downloaded image or decoded JSON data
+type MemoryInput struct {
+	name        string
+	contentType string
+	data        []byte
+}
+
+// NewMemoryInput creates a conversion input from in-memory data
+func NewMemoryInput(name, contentType string, data []byte) *MemoryInput {
+	return &MemoryInput{
+		name:        name,
+		contentType: contentType,
+		data:        data,
+	}
+}
+
+// Name returns the filename
+func (i *MemoryInput) Name() string {
+	return i.name
+}
+
+// ContentType returns the MIME type of the data
+func (i *MemoryInput) ContentType() string {
+	return i.contentType
+}
+
+// Size returns the length of the data
+func (i *MemoryInput) Size() int64 {
+	return int64(len(i.data))
+}
+
+// Open returns a reader over the data
+func (i *MemoryInput) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(i.data)), nil
+}
+
+// contextReader stops reading once ctx is cancelled, so large inputs don't outlive their request
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read reads from the underlying reader unless ctx is done
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
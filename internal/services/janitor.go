@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"img-to-pdf-converter/internal/config"
+)
+
+// tempPrefixes are the name prefixes of the temp files and directories conversions create
+var tempPrefixes = []string{"conversion_", "rasterize_", "output_"}
+
+// Janitor periodically deletes expired outputs from storage and temp files left behind by
+// conversions that never finished, e.g. because the process crashed.
+type Janitor struct {
+	config      *config.Config
+	storage     Storage
+	fileService *FileService
+}
+
+// NewJanitor creates a new janitor instance
+func NewJanitor(cfg *config.Config, storage Storage, fileService *FileService) *Janitor {
+	return &Janitor{
+		config:      cfg,
+		storage:     storage,
+		fileService: fileService,
+	}
+}
+
+// Start sweeps once right away and then on every interval until ctx is cancelled
+func (j *Janitor) Start(ctx context.Context) {
+	j.Sweep(ctx)
+	if j.config.Janitor.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(j.config.Janitor.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				j.Sweep(ctx)
+			}
+		}
+	}()
+}
+
+// partialRemover is implemented by storage backends that can leave partially written files behind
+type partialRemover interface {
+	RemovePartials(olderThan time.Time) (int, error)
+}
+
+// Sweep deletes expired outputs and stale temp files
+func (j *Janitor) Sweep(ctx context.Context) {
+	now := time.Now()
+	outputs := j.sweepOutputs(ctx, now)
+	temps := j.sweepTemp(now) + j.sweepPartials(now)
+	if outputs > 0 || temps > 0 {
+		slog.InfoContext(ctx, "Janitor sweep finished", "expired_outputs", outputs, "stale_temp_entries", temps)
+	}
+}
+
+// sweepOutputs deletes the outputs in storage that are older than the TTL
+func (j *Janitor) sweepOutputs(ctx context.Context, now time.Time) int {
+	if j.config.Janitor.OutputTTL <= 0 {
+		return 0
+	}
+
+	objects, err := j.storage.List(ctx, "")
+	if err != nil {
+		slog.WarnContext(ctx, "Janitor failed to list outputs", "error", err)
+		return 0
+	}
+
+	removed := 0
+	for _, object := range objects {
+		if now.Sub(object.ModTime) < j.config.Janitor.OutputTTL {
+			continue
+		}
+		if err := j.storage.Delete(ctx, object.Name); err != nil {
+			slog.WarnContext(ctx, "Janitor failed to remove output", "output", object.Name, "error", err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+// sweepTemp deletes the conversion temp files and directories older than the maximum age
+func (j *Janitor) sweepTemp(now time.Time) int {
+	entries, err := os.ReadDir(j.config.Upload.TempDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("Janitor failed to read temp directory", "error", err)
+		}
+		return 0
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if !hasTempPrefix(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < j.config.Janitor.TempMaxAge {
+			continue
+		}
+
+		path := filepath.Join(j.config.Upload.TempDir, entry.Name())
+		if entry.IsDir() {
+			err = j.fileService.CleanupDirectory(path)
+		} else {
+			err = j.fileService.CleanupFile(path)
+		}
+		if err != nil {
+			slog.Warn("Janitor failed to remove temp entry", "path", path, "error", err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+// sweepPartials deletes the partial output files of writes interrupted by a crash
+func (j *Janitor) sweepPartials(now time.Time) int {
+	remover, ok := j.storage.(partialRemover)
+	if !ok {
+		return 0
+	}
+	removed, err := remover.RemovePartials(now.Add(-j.config.Janitor.TempMaxAge))
+	if err != nil {
+		slog.Warn("Janitor failed to remove partial outputs", "error", err)
+	}
+	return removed
+}
+
+// hasTempPrefix checks if a temp directory entry was created by a conversion
+func hasTempPrefix(name string) bool {
+	for _, prefix := range tempPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,256 +1,393 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"mime/multipart"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/jung-kurt/gofpdf"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"img-to-pdf-converter/internal/config"
+	"img-to-pdf-converter/internal/metrics"
+	"img-to-pdf-converter/internal/tracing"
+	"img-to-pdf-converter/pkg/converter"
 )
 
+// ErrConversionTimeout is returned when a conversion exceeds the configured deadline
+var ErrConversionTimeout = errors.New("conversion timed out")
+
 // PDFService handles PDF conversion operations
 type PDFService struct {
-	config *config.Config
+	config     *config.Config
+	storage    Storage
+	rasterizer converter.Rasterizer
 }
 
 // ConversionOptions holds the conversion parameters
 type ConversionOptions struct {
-	Fit         bool   `json:"fit"`         // Fit small images to page
-	Position    string `json:"position"`    // Image positioning
-	Orientation string `json:"orientation"` // PDF orientation
+	Fit          bool   `json:"fit"`          // Fit small images to page
+	Position     string `json:"position"`     // Image positioning
+	Orientation  string `json:"orientation"`  // PDF orientation
+	OutputFormat string `json:"outputFormat"` // Output format: pdf, tiff or zip
 }
 
-// Margins defines page margins
-type Margins struct {
-	Top, Right, Bottom, Left float64
+// Supported output formats for a conversion
+const (
+	OutputFormatPDF  = converter.FormatPDF
+	OutputFormatTIFF = converter.FormatTIFF
+	OutputFormatZIP  = converter.FormatZIP
+)
+
+// IsValidOutputFormat checks if the output format is supported
+func IsValidOutputFormat(format string) bool {
+	return converter.IsValidFormat(format)
 }
 
-// NewPDFService creates a new PDF service instance
-func NewPDFService(cfg *config.Config) *PDFService {
+// NewPDFService creates a new PDF service instance that keeps generated files in storage
+func NewPDFService(cfg *config.Config, storage Storage) *PDFService {
 	return &PDFService{
-		config: cfg,
+		config:     cfg,
+		storage:    storage,
+		rasterizer: converter.NewPopplerRasterizer(cfg.PDF.RasterizerPath),
 	}
 }
 
-// ConvertImagesToPDF converts uploaded images to a single PDF file with options
-func (s *PDFService) ConvertImagesToPDF(files []*multipart.FileHeader) (string, error) {
-	return s.ConvertImagesToPDFWithOptions(files, ConversionOptions{
-		Fit:         false,
-		Position:    "center",
-		Orientation: "P", // Portrait by default
+// SetRasterizer replaces the PDF rasterizer used for PDF to image conversion and rendered pages
+func (s *PDFService) SetRasterizer(rasterizer converter.Rasterizer) {
+	s.rasterizer = rasterizer
+}
+
+// ConvertImagesToPDF converts uploaded images (and PDF documents) to a single PDF file and returns its name in storage
+func (s *PDFService) ConvertImagesToPDF(ctx context.Context, files []ImageInput) (string, error) {
+	return s.ConvertImagesToPDFWithOptions(ctx, files, ConversionOptions{
+		Fit:          false,
+		Position:     "center",
+		Orientation:  s.config.PDF.Orientation,
+		OutputFormat: OutputFormatPDF,
 	})
 }
 
 // ConvertImagesToPDFWithOptions converts uploaded images to a single PDF file with conversion options
-func (s *PDFService) ConvertImagesToPDFWithOptions(files []*multipart.FileHeader, options ConversionOptions) (string, error) {
-	if len(files) == 0 {
-		return "", fmt.Errorf("no files provided")
+// and returns its name in storage. Depending on the output format the result is a multipage TIFF
+// or a ZIP of normalised images instead.
+// It stops when ctx is cancelled or the conversion timeout passes, removing any partial output.
+func (s *PDFService) ConvertImagesToPDFWithOptions(ctx context.Context, files []ImageInput, options ConversionOptions) (string, error) {
+	format := getOutputFormat(options)
+	if !IsValidOutputFormat(format) {
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+
+	outputName := s.newOutputName("converted_images", format)
+	err := s.saveOutput(ctx, outputName, func(w io.Writer) error {
+		return s.ConvertImagesToWriter(ctx, files, options, w)
+	})
+	if err != nil {
+		return "", err
 	}
 
-	// Create output directory if it doesn't exist
-	if err := s.ensureDirectory(s.config.PDF.OutputDir); err != nil {
-		return "", fmt.Errorf("failed to create output directory: %v", err)
+	slog.InfoContext(ctx, "Output saved", "format", format, "output", outputName)
+	return outputName, nil
+}
+
+// ConvertImagesToWriter converts uploaded images with conversion options and writes the document to w.
+// The conversion itself is done by the converter package. PDF and TIFF output is only written once
+// every input has been processed, while ZIP output is written page by page.
+func (s *PDFService) ConvertImagesToWriter(ctx context.Context, files []ImageInput, options ConversionOptions, w io.Writer) (err error) {
+	if len(files) == 0 {
+		return fmt.Errorf("no files provided")
 	}
 
-	// Create temporary directory for processing
-	tempDir := filepath.Join(s.config.Upload.TempDir, fmt.Sprintf("conversion_%d", time.Now().Unix()))
-	if err := s.ensureDirectory(tempDir); err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %v", err)
+	format := getOutputFormat(options)
+	if !IsValidOutputFormat(format) {
+		return fmt.Errorf("unsupported output format: %s", format)
 	}
-	defer s.cleanupDirectory(tempDir)
 
-	// Save uploaded files to temp directory
-	var imagePaths []string
-	for i, fileHeader := range files {
-		tempPath, err := s.saveUploadedFile(fileHeader, tempDir, fmt.Sprintf("image_%d_%s", i, fileHeader.Filename))
+	ctx, span := tracing.Start(ctx, "PDFService.ConvertImagesToWriter",
+		attribute.Int("files.count", len(files)),
+		attribute.Int64("files.bytes", totalSize(files)),
+		attribute.String("options.format", format),
+		attribute.Bool("options.fit", options.Fit),
+		attribute.String("options.position", options.Position),
+		attribute.String("options.orientation", options.Orientation))
+
+	start := time.Now()
+	output := &countingWriter{w: w}
+	defer func() {
+		observeConversion(format, start, err)
+		metrics.OutputBytes.WithLabelValues(format).Add(float64(output.n))
+		span.SetAttributes(attribute.Int64("output.bytes", output.n))
+		tracing.End(span, err)
+	}()
+
+	ctx, cancel := s.withConversionTimeout(ctx)
+	defer cancel()
+
+	// Open every input, the converter reads them in order
+	sources := make([]converter.ImageSource, 0, len(files))
+	for _, file := range files {
+		src, err := file.Open()
 		if err != nil {
-			return "", fmt.Errorf("failed to save file %s: %v", fileHeader.Filename, err)
+			return fmt.Errorf("failed to open file %s: %v", file.Name(), err)
 		}
-		imagePaths = append(imagePaths, tempPath)
-	}
+		defer src.Close()
 
-	// Generate PDF with options
-	pdfPath, err := s.generatePDFWithOptions(imagePaths, options)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate PDF: %v", err)
+		sources = append(sources, converter.ImageSource{
+			Name:        file.Name(),
+			ContentType: file.ContentType(),
+			Reader:      contextReader{ctx: ctx, r: src},
+		})
 	}
 
-	return pdfPath, nil
-}
+	// Requests without an orientation get the configured one
+	orientation := options.Orientation
+	if orientation == "" {
+		orientation = s.config.PDF.Orientation
+	}
 
-// saveUploadedFile saves an uploaded file to the specified directory
-func (s *PDFService) saveUploadedFile(fileHeader *multipart.FileHeader, destDir, filename string) (string, error) {
-	src, err := fileHeader.Open()
-	if err != nil {
-		return "", fmt.Errorf("failed to open uploaded file: %v", err)
+	var stepTracer converter.Tracer
+	if trace.SpanFromContext(ctx).IsRecording() {
+		stepTracer = spanStepTracer{}
 	}
-	defer src.Close()
 
-	destPath := filepath.Join(destDir, filename)
-	dst, err := os.Create(destPath)
+	report, err := converter.Convert(ctx, sources, converter.Options{
+		Fit:           options.Fit,
+		Position:      options.Position,
+		Orientation:   orientation,
+		PageSize:      s.config.PDF.PageFormat,
+		Format:        format,
+		DPI:           s.config.PDF.DefaultRasterDPI,
+		Rasterizer:    s.rasterizer,
+		TempDir:       s.config.Upload.TempDir,
+		MaxSourceSize: s.config.Upload.LargestFileSize(),
+		MaxPages:      maxPagesFromContext(ctx),
+		MaxPagePixels: s.config.Upload.MaxImageMegapixels * 1e6,
+		Tracer:        stepTracer,
+	}, output)
 	if err != nil {
-		return "", fmt.Errorf("failed to create destination file: %v", err)
+		if ctxErr := conversionContextError(ctx); ctxErr != nil {
+			return ctxErr
+		}
+		if errors.Is(err, converter.ErrTooManyPages) {
+			return ErrPageLimitExceeded
+		}
+		if errors.Is(err, converter.ErrPageTooLarge) {
+			return reject(metrics.RejectTooManyPixels, err)
+		}
+		return fmt.Errorf("failed to generate %s: %v", strings.ToUpper(format), err)
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, src); err != nil {
-		return "", fmt.Errorf("failed to copy file: %v", err)
+	for _, source := range report.Sources {
+		if source.Skipped {
+			slog.WarnContext(ctx, "Skipped source", "source", source.Name, "reason", source.Reason)
+			metrics.ImageEmbedFailures.Inc()
+		}
 	}
 
-	log.Printf("Saved file: %s (size: %d bytes)", destPath, fileHeader.Size)
-	return destPath, nil
+	span.SetAttributes(attribute.Int("output.pages", report.Pages))
+	slog.InfoContext(ctx, "Document generated", "format", format, "pages", report.Pages)
+	return nil
 }
 
-// generatePDFWithOptions creates a PDF from the provided image paths with conversion options
-func (s *PDFService) generatePDFWithOptions(imagePaths []string, options ConversionOptions) (string, error) {
-	if len(imagePaths) == 0 {
-		return "", fmt.Errorf("no images provided")
-	}
+// spanStepTracer records the steps of a conversion as child spans of the conversion span
+type spanStepTracer struct{}
 
-	// Validate and set default orientation
-	orientation := options.Orientation
-	if orientation != "L" && orientation != "P" {
-		orientation = "P" // Default to Portrait
+// StartStep starts a span for a conversion step
+func (spanStepTracer) StartStep(ctx context.Context, name string, attrs map[string]any) func(err error) {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
 	}
-
-	// Create PDF with specified orientation
-	pdf := gofpdf.New(orientation, "mm", "A4", "")
-
-	// Calculate page dimensions based on orientation
-	var pageW, pageH float64
-	if orientation == "L" {
-		pageW, pageH = 297.0, 210.0 // Landscape A4
-	} else {
-		pageW, pageH = 210.0, 297.0 // Portrait A4
+	sort.Strings(keys)
+
+	spanAttrs := make([]attribute.KeyValue, 0, len(keys))
+	for _, key := range keys {
+		switch value := attrs[key].(type) {
+		case int:
+			spanAttrs = append(spanAttrs, attribute.Int(key, value))
+		case int64:
+			spanAttrs = append(spanAttrs, attribute.Int64(key, value))
+		case bool:
+			spanAttrs = append(spanAttrs, attribute.Bool(key, value))
+		case string:
+			spanAttrs = append(spanAttrs, attribute.String(key, value))
+		default:
+			spanAttrs = append(spanAttrs, attribute.String(key, fmt.Sprint(value)))
+		}
 	}
 
-	// Define margins
-	margins := Margins{
-		Top:    10,
-		Right:  10,
-		Bottom: 10,
-		Left:   10,
+	_, span := tracing.Start(ctx, name, spanAttrs...)
+	return func(err error) {
+		tracing.End(span, err)
 	}
+}
 
-	// Calculate usable area
-	usableW := pageW - (margins.Left + margins.Right)
-	usableH := pageH - (margins.Top + margins.Bottom)
+// getOutputFormat returns the output format of the options, PDF when unset
+func getOutputFormat(options ConversionOptions) string {
+	if options.OutputFormat == "" {
+		return OutputFormatPDF
+	}
+	return options.OutputFormat
+}
 
-	for i, imagePath := range imagePaths {
-		log.Printf("Processing image %d: %s", i+1, imagePath)
+// withConversionTimeout bounds ctx by the configured conversion timeout, if any
+func (s *PDFService) withConversionTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config.PDF.ConversionTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.config.PDF.ConversionTimeout)
+}
 
-		// Check if file exists
-		if _, err := os.Stat(imagePath); os.IsNotExist(err) {
-			log.Printf("Warning: Image file does not exist: %s", imagePath)
-			continue
-		}
+// conversionContextError reports why a conversion context ended, or nil if it is still active.
+// A passed deadline becomes ErrConversionTimeout, a cancelled request is returned as context.Canceled.
+func conversionContextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return ErrConversionTimeout
+	default:
+		return context.Canceled
+	}
+}
 
-		// Add new page
-		pdf.AddPage()
+// observeConversion records the duration and result of a conversion
+func observeConversion(format string, start time.Time, err error) {
+	result := "success"
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrConversionTimeout):
+		result = "timeout"
+	case errors.Is(err, context.Canceled):
+		result = "cancelled"
+	case errors.Is(err, ErrPageLimitExceeded):
+		result = "page_limit"
+	default:
+		result = "error"
+	}
+	metrics.ConversionDuration.WithLabelValues(format, result).Observe(time.Since(start).Seconds())
+}
 
-		// Register image and get dimensions
-		info := pdf.RegisterImage(imagePath, "")
-		if info == nil {
-			log.Printf("Warning: Failed to register image: %s", imagePath)
-			continue
-		}
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
 
-		imgW, imgH := info.Extent()
-		log.Printf("Original image dimensions: %.2f x %.2f", imgW, imgH)
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
 
-		// Calculate new dimensions
-		newW, newH := s.calculateOptimalDimensions(imgW, imgH, usableW, usableH, options.Fit)
-		log.Printf("Calculated dimensions: %.2f x %.2f", newW, newH)
+// saveUploadedFile saves an uploaded file to the specified directory
+func (s *PDFService) saveUploadedFile(ctx context.Context, file ImageInput, destDir, filename string) (_ string, err error) {
+	_, span := tracing.Start(ctx, "PDFService.saveUploadedFile",
+		attribute.String("file.name", file.Name()),
+		attribute.String("file.content_type", file.ContentType()),
+		attribute.Int64("file.size", file.Size()))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 
-		// Calculate position
-		x, y := s.calculatePosition(options.Position, usableW, usableH, newW, newH)
-		x += margins.Left
-		y += margins.Top
+	src, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded file: %v", err)
+	}
+	defer src.Close()
 
-		log.Printf("Image position: %.2f, %.2f", x, y)
+	destPath := filepath.Join(destDir, filename)
+	dst, err := os.Create(destPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create destination file: %v", err)
+	}
+	defer dst.Close()
 
-		// Add image to PDF
-		pdf.ImageOptions(imagePath, x, y, newW, newH, false, gofpdf.ImageOptions{}, 0, "")
-		log.Printf("Added image to PDF: %s", imagePath)
+	if _, err := io.Copy(dst, contextReader{ctx: ctx, r: src}); err != nil {
+		return "", fmt.Errorf("failed to copy file: %v", err)
 	}
 
-	// Generate output filename
-	timestamp := time.Now().Format("20060102_150405")
-	outputFilename := fmt.Sprintf("converted_images_%s.pdf", timestamp)
-	outputPath := filepath.Join(s.config.PDF.OutputDir, outputFilename)
+	slog.DebugContext(ctx, "Saved uploaded file", "path", destPath, "bytes", file.Size())
+	return destPath, nil
+}
 
-	// Save PDF
-	if err := pdf.OutputFileAndClose(outputPath); err != nil {
-		return "", fmt.Errorf("failed to save PDF: %v", err)
-	}
+// newOutputName returns a unique name for a generated file
+func (s *PDFService) newOutputName(prefix, extension string) string {
+	return s.newOutputBase(prefix) + "." + extension
+}
 
-	log.Printf("PDF saved: %s", outputPath)
-	return outputPath, nil
+// newOutputBase returns a unique name without extension for generated files.
+// A random suffix keeps outputs created within the same second apart.
+func (s *PDFService) newOutputBase(prefix string) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s_%s_%s", prefix, time.Now().Format("20060102_150405"), hex.EncodeToString(suffix))
 }
 
-// calculateOptimalDimensions calculates optimal image dimensions based on fit option
-func (s *PDFService) calculateOptimalDimensions(imgW, imgH, usableW, usableH float64, fit bool) (float64, float64) {
-	newW, newH := imgW, imgH
-
-	// If image is larger than usable area, scale it down
-	if imgW > usableW || imgH > usableH {
-		ratio := s.min(usableW/imgW, usableH/imgH)
-		newW = imgW * ratio
-		newH = imgH * ratio
-	} else if fit {
-		// If fit is enabled and image is smaller, scale it up to fit the area
-		ratio := s.min(usableW/imgW, usableH/imgH)
-		newW = imgW * ratio
-		newH = imgH * ratio
+// saveOutput stores the data produced by write under name. The data is spooled to a temporary
+// file first, so storage backends get a known size and nothing is stored when write fails.
+func (s *PDFService) saveOutput(ctx context.Context, name string, write func(w io.Writer) error) error {
+	if err := s.ensureDirectory(s.config.Upload.TempDir); err != nil {
+		return fmt.Errorf("failed to create temp directory: %v", err)
 	}
+	temp, err := os.CreateTemp(s.config.Upload.TempDir, "output_*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
 
-	return newW, newH
+	if err := write(temp); err != nil {
+		return err
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read output: %v", err)
+	}
+	return s.storeFile(ctx, name, temp)
 }
 
-// calculatePosition calculates image position based on position option
-func (s *PDFService) calculatePosition(pos string, areaW, areaH, imgW, imgH float64) (float64, float64) {
-	var x, y float64
-
-	switch strings.ToLower(pos) {
-	case "top-left":
-		x, y = 0, 0
-	case "top-center", "top":
-		x, y = (areaW-imgW)/2, 0
-	case "top-right":
-		x, y = areaW-imgW, 0
-	case "center-left", "left":
-		x, y = 0, (areaH-imgH)/2
-	case "center", "center-center", "":
-		x, y = (areaW-imgW)/2, (areaH-imgH)/2
-	case "center-right", "right":
-		x, y = areaW-imgW, (areaH-imgH)/2
-	case "bottom-left":
-		x, y = 0, areaH-imgH
-	case "bottom-center", "bottom":
-		x, y = (areaW-imgW)/2, areaH-imgH
-	case "bottom-right":
-		x, y = areaW-imgW, areaH-imgH
-	default:
-		// Default to center
-		x, y = (areaW-imgW)/2, (areaH-imgH)/2
+// storeFile copies a local file into storage under name
+func (s *PDFService) storeFile(ctx context.Context, name string, file *os.File) (err error) {
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read output: %v", err)
 	}
 
-	return x, y
+	ctx, span := tracing.Start(ctx, "PDFService.storeFile",
+		attribute.String("output.name", name),
+		attribute.Int64("output.bytes", info.Size()),
+		attribute.String("storage.backend", s.config.Storage.Backend))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	if err := s.storage.Put(ctx, name, file, info.Size()); err != nil {
+		if ctxErr := conversionContextError(ctx); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("failed to store %s: %v", name, err)
+	}
+	return nil
 }
 
-// min returns the minimum of two float64 values
-func (s *PDFService) min(a, b float64) float64 {
-	if a < b {
-		return a
+// removeOutput deletes a generated file from storage, logging failures.
+// It also runs when ctx was cancelled, which is when outputs are cleaned up most.
+func (s *PDFService) removeOutput(ctx context.Context, name string) {
+	if err := s.storage.Delete(context.WithoutCancel(ctx), name); err != nil {
+		slog.WarnContext(ctx, "Failed to remove output", "output", name, "error", err)
 	}
-	return b
 }
 
 // ensureDirectory creates a directory if it doesn't exist
@@ -262,8 +399,8 @@ func (s *PDFService) ensureDirectory(dir string) error {
 }
 
 // cleanupDirectory removes a directory and its contents
-func (s *PDFService) cleanupDirectory(dir string) {
+func (s *PDFService) cleanupDirectory(ctx context.Context, dir string) {
 	if err := os.RemoveAll(dir); err != nil {
-		log.Printf("Warning: Failed to cleanup directory %s: %v", dir, err)
+		slog.WarnContext(ctx, "Failed to clean up directory", "path", dir, "error", err)
 	}
 }
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// stallingInput calls onRead before every read of its content, to end the conversion context mid-conversion
+type stallingInput struct {
+	*MemoryInput
+	onRead func()
+}
+
+func (i *stallingInput) Open() (io.ReadCloser, error) {
+	src, err := i.MemoryInput.Open()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{readerFunc(func(p []byte) (int, error) {
+		i.onRead()
+		return src.Read(p)
+	}), src}, nil
+}
+
+// readerFunc adapts a function to io.Reader
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// stubRasterizer writes a page image per page into outDir, then calls onDone
+type stubRasterizer struct {
+	pages  int
+	onDone func()
+}
+
+func (r *stubRasterizer) Rasterize(ctx context.Context, pdfPath, outDir, format string, dpi int) ([]string, error) {
+	var paths []string
+	for i := 1; i <= r.pages; i++ {
+		path := filepath.Join(outDir, fmt.Sprintf("page-%d.%s", i, format))
+		if err := os.WriteFile(path, []byte("page"), 0644); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	r.onDone()
+	return paths, nil
+}
+
+// cancellingStorage cancels the request when the given Put call starts, as a client hanging up would
+type cancellingStorage struct {
+	*MemoryStorage
+	cancelOn int
+	cancel   context.CancelFunc
+	puts     int
+}
+
+func (s *cancellingStorage) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	s.puts++
+	if s.puts == s.cancelOn {
+		s.cancel()
+		return ctx.Err()
+	}
+	return s.MemoryStorage.Put(ctx, name, r, size)
+}
+
+// testPDF returns a PDF document with the given number of A4 pages
+func testPDF(t *testing.T, pages int) []byte {
+	t.Helper()
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	for i := 0; i < pages; i++ {
+		pdf.AddPage()
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatalf("failed to create test PDF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// assertCleanedUp fails the test if storage holds any object or the temp dir any file
+func assertCleanedUp(t *testing.T, storage *MemoryStorage, tempDir string) {
+	t.Helper()
+	objects, err := storage.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, object := range objects {
+		t.Errorf("storage still holds %s", object.Name)
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("temp dir still holds %s", entry.Name())
+	}
+}
+
+func TestConvertImagesContextEnds(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		timeout time.Duration
+		want    error
+	}{
+		{name: "PDF cancelled", format: OutputFormatPDF, want: context.Canceled},
+		{name: "TIFF cancelled", format: OutputFormatTIFF, want: context.Canceled},
+		{name: "ZIP cancelled", format: OutputFormatZIP, want: context.Canceled},
+		{name: "PDF timed out", format: OutputFormatPDF, timeout: 50 * time.Millisecond, want: ErrConversionTimeout},
+		{name: "ZIP timed out", format: OutputFormatZIP, timeout: 50 * time.Millisecond, want: ErrConversionTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.PDF.ConversionTimeout = tt.timeout
+			storage := NewMemoryStorage()
+			s := NewPDFService(cfg, storage)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The first image is converted, the context ends while the second one is read
+			stalling := &stallingInput{MemoryInput: NewMemoryInput("b.png", "image/png", testPNG(t, 10, 20)), onRead: func() {
+				if tt.timeout > 0 {
+					time.Sleep(2 * tt.timeout)
+				} else {
+					cancel()
+				}
+			}}
+			files := []ImageInput{NewMemoryInput("a.png", "image/png", testPNG(t, 20, 10)), stalling}
+
+			name, err := s.ConvertImagesToPDFWithOptions(ctx, files, ConversionOptions{Position: "center", OutputFormat: tt.format})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ConvertImagesToPDFWithOptions() error = %v, want %v", err, tt.want)
+			}
+			if name != "" {
+				t.Errorf("ConvertImagesToPDFWithOptions() = %q, want no output", name)
+			}
+			assertCleanedUp(t, storage, cfg.Upload.TempDir)
+		})
+	}
+}
+
+func TestConvertPDFToImagesContextEnds(t *testing.T) {
+	tests := []struct {
+		name     string
+		zip      bool
+		cancelOn string // rasterize: after rendering, store: while storing the second page
+	}{
+		{name: "cancelled after rendering", cancelOn: "rasterize"},
+		{name: "cancelled after rendering to ZIP", zip: true, cancelOn: "rasterize"},
+		{name: "cancelled while storing pages", cancelOn: "store"},
+		{name: "cancelled while storing ZIP", zip: true, cancelOn: "store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cfg := testConfig(t)
+			memory := NewMemoryStorage()
+			storage := &cancellingStorage{MemoryStorage: memory, cancel: cancel}
+			rasterizer := &stubRasterizer{pages: 3, onDone: func() {}}
+			switch tt.cancelOn {
+			case "rasterize":
+				rasterizer.onDone = cancel
+			case "store":
+				storage.cancelOn = 2
+				if tt.zip {
+					storage.cancelOn = 1
+				}
+			}
+			s := NewPDFService(cfg, storage)
+			s.SetRasterizer(rasterizer)
+
+			input := NewMemoryInput("document.pdf", PDFContentType, testPDF(t, 3))
+			outputs, err := s.ConvertPDFToImages(ctx, input, RasterOptions{Format: "png", DPI: 72, Zip: tt.zip})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("ConvertPDFToImages() error = %v, want %v", err, context.Canceled)
+			}
+			if outputs != nil {
+				t.Errorf("ConvertPDFToImages() = %v, want no outputs", outputs)
+			}
+			assertCleanedUp(t, memory, cfg.Upload.TempDir)
+		})
+	}
+}
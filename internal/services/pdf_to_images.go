@@ -0,0 +1,199 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"img-to-pdf-converter/internal/metrics"
+	"img-to-pdf-converter/pkg/converter"
+)
+
+// RasterOptions holds the parameters for converting a PDF to images
+type RasterOptions struct {
+	Format string `json:"format"` // Output image format: png or jpeg
+	DPI    int    `json:"dpi"`    // Render resolution
+	Zip    bool   `json:"zip"`    // Pack the pages in a single ZIP archive
+}
+
+// ConvertPDFToImages renders the pages of an uploaded PDF to images in storage.
+// It returns either the name of a ZIP archive holding all pages or the names of the page images.
+// It stops when ctx is cancelled or the conversion timeout passes, removing any partial output.
+func (s *PDFService) ConvertPDFToImages(ctx context.Context, file ImageInput, options RasterOptions) (_ []string, err error) {
+	if options.Format != "png" && options.Format != "jpeg" {
+		return nil, fmt.Errorf("unsupported image format: %s", options.Format)
+	}
+	if options.DPI <= 0 || options.DPI > s.config.PDF.MaxRasterDPI {
+		return nil, fmt.Errorf("invalid DPI: %d (max: %d)", options.DPI, s.config.PDF.MaxRasterDPI)
+	}
+
+	start := time.Now()
+	defer func() {
+		observeConversion(options.Format, start, err)
+	}()
+
+	ctx, cancel := s.withConversionTimeout(ctx)
+	defer cancel()
+
+	// Create temporary directory for processing
+	tempDir := filepath.Join(s.config.Upload.TempDir, fmt.Sprintf("rasterize_%d", time.Now().UnixNano()))
+	if err := s.ensureDirectory(tempDir); err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer s.cleanupDirectory(ctx, tempDir)
+
+	pdfPath, err := s.saveUploadedFile(ctx, file, tempDir, "source.pdf")
+	if err != nil {
+		if ctxErr := conversionContextError(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("failed to save file %s: %v", file.Name(), err)
+	}
+
+	// Count the pages before rendering any of them
+	pageSizes, err := converter.PDFPageSizes(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %v", err)
+	}
+	if maxPages := maxPagesFromContext(ctx); maxPages > 0 && len(pageSizes) > maxPages {
+		return nil, ErrPageLimitExceeded
+	}
+	// Pages are held in memory while rendering, and a few bytes can declare a huge page
+	for i, size := range pageSizes {
+		if pixels := size.Pixels(options.DPI); pixels > s.config.Upload.MaxImageMegapixels*1e6 {
+			return nil, reject(metrics.RejectTooManyPixels, fmt.Errorf("page %d is too large: %.1f megapixels at %d DPI (max: %g megapixels)",
+				i+1, pixels/1e6, options.DPI, s.config.Upload.MaxImageMegapixels))
+		}
+	}
+
+	pages, err := s.rasterizer.Rasterize(ctx, pdfPath, tempDir, options.Format, options.DPI)
+	if err != nil {
+		if ctxErr := conversionContextError(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("failed to render PDF: %v", err)
+	}
+	slog.InfoContext(ctx, "PDF rendered", "pages", len(pages), "dpi", options.DPI)
+
+	// Nobody is waiting for the pages anymore
+	if ctxErr := conversionContextError(ctx); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	if options.Zip {
+		zipName := s.newOutputName("pdf_pages", "zip")
+		err := s.saveOutput(ctx, zipName, func(w io.Writer) error {
+			return writeZip(w, zipEntriesForFiles(pages))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ZIP archive: %w", err)
+		}
+		slog.InfoContext(ctx, "ZIP archive saved", "output", zipName)
+		return []string{zipName}, nil
+	}
+
+	// Store the rendered pages next to the generated PDFs so the download endpoint can serve them
+	baseName := s.newOutputBase("pdf_pages")
+	var outputs []string
+	for _, page := range pages {
+		outputName := baseName + "_" + filepath.Base(page)
+		if err := s.storePage(ctx, outputName, page); err != nil {
+			for _, output := range outputs {
+				s.removeOutput(ctx, output)
+			}
+			return nil, err
+		}
+		outputs = append(outputs, outputName)
+	}
+
+	return outputs, nil
+}
+
+// storePage copies a rendered page into storage
+func (s *PDFService) storePage(ctx context.Context, name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to store page %s: %v", filepath.Base(path), err)
+	}
+	defer file.Close()
+
+	return s.storeFile(ctx, name, file)
+}
+
+// zipEntry is a file to pack into a ZIP archive under the given name
+type zipEntry struct {
+	Name string
+	Open func() (io.ReadCloser, error)
+}
+
+// zipEntriesForFiles returns entries that store each local file under its base name
+func zipEntriesForFiles(paths []string) []zipEntry {
+	entries := make([]zipEntry, 0, len(paths))
+	for _, path := range paths {
+		entries = append(entries, zipEntryForFile(path))
+	}
+	return entries
+}
+
+// zipEntryForFile returns an entry that stores the local file under its base name
+func zipEntryForFile(path string) zipEntry {
+	return zipEntry{
+		Name: filepath.Base(path),
+		Open: func() (io.ReadCloser, error) { return os.Open(path) },
+	}
+}
+
+// storedZipEntry returns an entry that packs the stored object under the given entry name
+func (s *PDFService) storedZipEntry(ctx context.Context, entryName, objectName string) zipEntry {
+	return zipEntry{
+		Name: entryName,
+		Open: func() (io.ReadCloser, error) {
+			rc, _, err := s.storage.Get(ctx, objectName)
+			return rc, err
+		},
+	}
+}
+
+// writeZip packs the given entries into a ZIP archive written to w
+func writeZip(w io.Writer, entries []zipEntry) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range entries {
+		if err := addEntryToZip(zw, entry); err != nil {
+			return fmt.Errorf("failed to add %s: %w", entry.Name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// addEntryToZip copies a single entry into the archive
+func addEntryToZip(zw *zip.Writer, entry zipEntry) error {
+	src, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Images are already compressed, storing them avoids wasted CPU
+	method := zip.Deflate
+	if ext := strings.ToLower(filepath.Ext(entry.Name)); ext == ".png" || ext == ".jpg" || ext == ".jpeg" {
+		method = zip.Store
+	}
+
+	dst, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     entry.Name,
+		Method:   method,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZipEntriesForFiles(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"page-1.png", "page-2.png", "page-3.png"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	// Entries are opened after the loop, each must still open its own file
+	for i, entry := range zipEntriesForFiles(paths) {
+		want := filepath.Base(paths[i])
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatalf("Open() of %s error = %v", entry.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if entry.Name != want || string(data) != want {
+			t.Errorf("entry %d = %s holding %q, want %s", i, entry.Name, data, want)
+		}
+	}
+}
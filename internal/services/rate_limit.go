@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Errors returned when a request gets no conversion slot
+var (
+	ErrServerBusy   = errors.New("too many concurrent conversions")
+	ErrShuttingDown = errors.New("server is shutting down")
+)
+
+// RateLimiter is a token bucket rate limiter with one bucket per client
+type RateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // Tokens added per second
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// tokenBucket holds the tokens of one client as of the last update
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter creates a limiter allowing requestsPerMinute sustained requests per client,
+// with bursts of up to burst requests
+func NewRateLimiter(requestsPerMinute float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:      requestsPerMinute / 60,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of client. When the bucket is empty it returns false
+// and how long the client has to wait for the next token.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops the buckets that have refilled completely, they are the same as new ones.
+// It runs at most once a minute so Allow stays cheap.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for client, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// ConversionLimiter caps the number of conversions running at the same time
+type ConversionLimiter struct {
+	slots        chan struct{}
+	waiting      atomic.Int64
+	queueTimeout time.Duration
+	closed       chan struct{}
+	closeOnce    sync.Once
+}
+
+// NewConversionLimiter creates a limiter for max concurrent conversions. Requests wait up to
+// queueTimeout for a free slot.
+func NewConversionLimiter(max int, queueTimeout time.Duration) *ConversionLimiter {
+	return &ConversionLimiter{
+		slots:        make(chan struct{}, max),
+		queueTimeout: queueTimeout,
+		closed:       make(chan struct{}),
+	}
+}
+
+// Acquire waits for a free conversion slot. It returns ErrServerBusy when none frees up
+// within the queue timeout, ErrShuttingDown once the limiter is closed, or the context error
+// when ctx ends first.
+func (l *ConversionLimiter) Acquire(ctx context.Context) error {
+	select {
+	case <-l.closed:
+		return ErrShuttingDown
+	default:
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if l.queueTimeout <= 0 {
+		return ErrServerBusy
+	}
+
+	l.waiting.Add(1)
+	defer l.waiting.Add(-1)
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrServerBusy
+	case <-l.closed:
+		return ErrShuttingDown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close fails the requests waiting for a slot and all later ones with ErrShuttingDown.
+// Conversions holding a slot are not affected.
+func (l *ConversionLimiter) Close() {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+}
+
+// Release frees a slot taken with Acquire
+func (l *ConversionLimiter) Release() {
+	<-l.slots
+}
+
+// InFlight returns the number of conversions currently running
+func (l *ConversionLimiter) InFlight() int {
+	return len(l.slots)
+}
+
+// Waiting returns the number of requests waiting for a conversion slot
+func (l *ConversionLimiter) Waiting() int {
+	return int(l.waiting.Load())
+}
+
+// Capacity returns the maximum number of concurrent conversions
+func (l *ConversionLimiter) Capacity() int {
+	return cap(l.slots)
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"img-to-pdf-converter/internal/config"
+)
+
+// Errors returned when a stored object can't be read
+var (
+	ErrObjectNotFound   = errors.New("object not found")
+	ErrObjectInProgress = errors.New("object is still being written")
+)
+
+// partialMarker is part of the names of files that are still being written
+const partialMarker = ".partial-"
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage keeps generated files where every replica of the service can reach them.
+// Object names are flat filenames without directories.
+type Storage interface {
+	// Put stores size bytes from r under name, replacing an existing object
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Get returns a reader for the object, the caller must close it.
+	// The reader also implements io.Seeker when the backend supports it.
+	Get(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error)
+	// Claim removes the object and returns a reader for its content, the caller must close it.
+	// Of several concurrent claims only one succeeds, the others get ErrObjectNotFound.
+	// The object is gone once Claim returns, a reader that fails halfway can't be claimed again.
+	Claim(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error)
+	// Delete removes the object, deleting a missing object is not an error
+	Delete(ctx context.Context, name string) error
+	// List returns the objects whose names start with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Stat returns information about the object
+	Stat(ctx context.Context, name string) (ObjectInfo, error)
+}
+
+// NewStorage creates the storage backend selected in the configuration
+func NewStorage(cfg *config.Config) (Storage, error) {
+	switch cfg.Storage.Backend {
+	case "filesystem", "":
+		return NewFilesystemStorage(cfg.PDF.OutputDir)
+	case "memory":
+		return NewMemoryStorage(), nil
+	case "s3":
+		return NewS3Storage(cfg.Storage)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Storage.Backend)
+	}
+}
+
+// IsPartialObjectName reports whether name is a file that is still being written
+func IsPartialObjectName(name string) bool {
+	return strings.Contains(name, partialMarker)
+}
+
+// validateObjectName rejects names that could address something outside the storage
+func validateObjectName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("invalid object name: %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilesystemStorage stores objects as files in a local directory
+type FilesystemStorage struct {
+	root string
+}
+
+// NewFilesystemStorage creates a storage in root, creating the directory if needed
+func NewFilesystemStorage(root string) (*FilesystemStorage, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	return &FilesystemStorage{root: root}, nil
+}
+
+// Put writes the object atomically. The data goes to a partial file in the same directory,
+// which is synced to disk and then renamed, so readers and crashes never see a truncated file.
+func (s *FilesystemStorage) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(s.root, name+partialMarker+"*")
+	if err != nil {
+		return err
+	}
+	partial := file.Name()
+	defer os.Remove(partial)
+
+	written, err := io.Copy(file, r)
+	if err == nil {
+		// Temp files are private, outputs keep the permissions os.Create gave them
+		err = file.Chmod(0644)
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("wrote %d of %d bytes", written, size)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(partial, path); err != nil {
+		return err
+	}
+	// Persist the rename itself, not every filesystem supports syncing directories
+	if dir, err := os.Open(s.root); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// Get opens the file of the object
+func (s *FilesystemStorage) Get(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, ObjectInfo{}, ErrObjectNotFound
+	}
+
+	return file, ObjectInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// claimedFile is an open file that was claimed, it is removed when closed
+type claimedFile struct {
+	*os.File
+}
+
+// Close closes and removes the file
+func (f claimedFile) Close() error {
+	err := f.File.Close()
+	if removeErr := os.Remove(f.Name()); err == nil && !os.IsNotExist(removeErr) {
+		err = removeErr
+	}
+	return err
+}
+
+// Claim renames the file of the object to a partial name, which only one caller can do, and opens it.
+// The partial file is removed when the reader is closed, or by RemovePartials after a crash.
+func (s *FilesystemStorage) Claim(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	claimed := path + partialMarker + "claimed-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := os.Rename(path, claimed); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ObjectInfo{}, ErrObjectNotFound
+		}
+		return nil, ObjectInfo{}, err
+	}
+	// Renaming keeps the old modification time, RemovePartials must not take the file while it is read
+	now := time.Now()
+	os.Chtimes(claimed, now, now)
+
+	file, err := os.Open(claimed)
+	if err != nil {
+		os.Remove(claimed)
+		return nil, ObjectInfo{}, err
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		claimedFile{file}.Close()
+		return nil, ObjectInfo{}, ErrObjectNotFound
+	}
+
+	return claimedFile{file}, ObjectInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the file of the object
+func (s *FilesystemStorage) Delete(ctx context.Context, name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns the files in the storage directory whose names start with prefix
+func (s *FilesystemStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []ObjectInfo
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) || IsPartialObjectName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since the directory was read
+			continue
+		}
+		objects = append(objects, ObjectInfo{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return objects, nil
+}
+
+// Stat returns the size and modification time of the object's file
+func (s *FilesystemStorage) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// RemovePartials deletes the partial files of writes that started before olderThan and
+// never finished, e.g. because the process crashed. It returns how many were removed.
+func (s *FilesystemStorage) RemovePartials(olderThan time.Time) (int, error) {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !IsPartialObjectName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(olderThan) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.root, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// path returns the file path of an object. Partial files are not objects yet.
+func (s *FilesystemStorage) path(name string) (string, error) {
+	if err := validateObjectName(name); err != nil {
+		return "", err
+	}
+	if IsPartialObjectName(name) {
+		return "", ErrObjectInProgress
+	}
+	return filepath.Join(s.root, name), nil
+}
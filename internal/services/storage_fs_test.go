@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestFilesystemStorage returns a filesystem storage in a temp dir
+func newTestFilesystemStorage(t *testing.T) (*FilesystemStorage, string) {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "output")
+	storage, err := NewFilesystemStorage(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage, root
+}
+
+// dirNames returns the sorted names of the files in dir
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readObject returns the content of an object, failing the test if it can't be read
+func readObject(t *testing.T, storage Storage, name string) string {
+	t.Helper()
+	r, _, err := storage.Get(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Get(%q) error = %v", name, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFilesystemStoragePutIsAtomic(t *testing.T) {
+	storage, root := newTestFilesystemStorage(t)
+	ctx := context.Background()
+	if err := storage.Put(ctx, "doc.pdf", strings.NewReader("old"), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// While the new content is written, readers still get the old object and the data is in a partial file
+	var during []string
+	snapshot := readerFunc(func([]byte) (int, error) {
+		during = dirNames(t, root)
+		if got := readObject(t, storage, "doc.pdf"); got != "old" {
+			t.Errorf("object during Put = %q, want %q", got, "old")
+		}
+		return 0, io.EOF
+	})
+	if err := storage.Put(ctx, "doc.pdf", io.MultiReader(snapshot, strings.NewReader("new content")), 11); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if len(during) != 2 || during[0] != "doc.pdf" || !strings.HasPrefix(during[1], "doc.pdf"+partialMarker) {
+		t.Errorf("files during Put = %v, want doc.pdf and its partial file", during)
+	}
+	if got := readObject(t, storage, "doc.pdf"); got != "new content" {
+		t.Errorf("object after Put = %q, want %q", got, "new content")
+	}
+	if names := dirNames(t, root); len(names) != 1 {
+		t.Errorf("files after Put = %v, want only doc.pdf", names)
+	}
+	info, err := os.Stat(filepath.Join(root, "doc.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0644 {
+		t.Errorf("permissions = %v, want %v", perm, os.FileMode(0644))
+	}
+}
+
+func TestFilesystemStorageFailedPutKeepsObject(t *testing.T) {
+	tests := []struct {
+		name string
+		r    io.Reader
+		size int64
+	}{
+		{name: "read error", r: io.MultiReader(strings.NewReader("new"), readerFunc(func([]byte) (int, error) {
+			return 0, errors.New("connection reset")
+		})), size: 10},
+		{name: "short content", r: strings.NewReader("new"), size: 10},
+		{name: "long content", r: strings.NewReader("new content"), size: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, root := newTestFilesystemStorage(t)
+			ctx := context.Background()
+			if err := storage.Put(ctx, "doc.pdf", strings.NewReader("old"), 3); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := storage.Put(ctx, "doc.pdf", tt.r, tt.size); err == nil {
+				t.Fatal("Put() error = nil, want an error")
+			}
+			if got := readObject(t, storage, "doc.pdf"); got != "old" {
+				t.Errorf("object after failed Put = %q, want %q", got, "old")
+			}
+			if names := dirNames(t, root); len(names) != 1 {
+				t.Errorf("files after failed Put = %v, want only doc.pdf", names)
+			}
+		})
+	}
+}
+
+func TestFilesystemStorageRejectsPartialNames(t *testing.T) {
+	storage, root := newTestFilesystemStorage(t)
+	ctx := context.Background()
+
+	// A write in progress, as Put leaves it
+	partial := "doc.pdf" + partialMarker + "123"
+	if err := os.WriteFile(filepath.Join(root, partial), []byte("half"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.Put(ctx, partial, strings.NewReader("data"), 4); !errors.Is(err, ErrObjectInProgress) {
+		t.Errorf("Put() error = %v, want %v", err, ErrObjectInProgress)
+	}
+	if _, _, err := storage.Get(ctx, partial); !errors.Is(err, ErrObjectInProgress) {
+		t.Errorf("Get() error = %v, want %v", err, ErrObjectInProgress)
+	}
+	if _, _, err := storage.Claim(ctx, partial); !errors.Is(err, ErrObjectInProgress) {
+		t.Errorf("Claim() error = %v, want %v", err, ErrObjectInProgress)
+	}
+	if _, err := storage.Stat(ctx, partial); !errors.Is(err, ErrObjectInProgress) {
+		t.Errorf("Stat() error = %v, want %v", err, ErrObjectInProgress)
+	}
+	if err := storage.Delete(ctx, partial); !errors.Is(err, ErrObjectInProgress) {
+		t.Errorf("Delete() error = %v, want %v", err, ErrObjectInProgress)
+	}
+
+	objects, err := storage.List(ctx, "doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("List() = %v, want no objects", objects)
+	}
+	if names := dirNames(t, root); len(names) != 1 || names[0] != partial {
+		t.Errorf("files = %v, want the partial file untouched", names)
+	}
+
+	for _, name := range []string{"", ".", "..", "../doc.pdf", "sub/doc.pdf", `sub\doc.pdf`} {
+		if err := storage.Put(ctx, name, strings.NewReader("data"), 4); err == nil {
+			t.Errorf("Put(%q) error = nil, want an error", name)
+		}
+	}
+}
+
+func TestFilesystemStorageClaim(t *testing.T) {
+	storage, root := newTestFilesystemStorage(t)
+	ctx := context.Background()
+	if err := storage.Put(ctx, "doc.pdf", strings.NewReader("content"), 7); err != nil {
+		t.Fatal(err)
+	}
+
+	r, info, err := storage.Claim(ctx, "doc.pdf")
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if info.Name != "doc.pdf" || info.Size != 7 {
+		t.Errorf("Claim() info = %+v, want doc.pdf of 7 bytes", info)
+	}
+
+	// Claimed, the object is gone for everyone else while its content is still read
+	if _, _, err := storage.Claim(ctx, "doc.pdf"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("second Claim() error = %v, want %v", err, ErrObjectNotFound)
+	}
+	if _, _, err := storage.Get(ctx, "doc.pdf"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Get() after Claim() error = %v, want %v", err, ErrObjectNotFound)
+	}
+	if objects, _ := storage.List(ctx, ""); len(objects) != 0 {
+		t.Errorf("List() after Claim() = %v, want no objects", objects)
+	}
+	if removed, err := storage.RemovePartials(time.Now().Add(-time.Minute)); err != nil || removed != 0 {
+		t.Errorf("RemovePartials() = %d, %v, want the claimed file kept while it is read", removed, err)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "content" {
+		t.Errorf("claimed content = %q, %v, want %q", data, err, "content")
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if names := dirNames(t, root); len(names) != 0 {
+		t.Errorf("files after Close() = %v, want none", names)
+	}
+}
+
+func TestFilesystemStorageRemovePartials(t *testing.T) {
+	storage, root := newTestFilesystemStorage(t)
+	ctx := context.Background()
+	if err := storage.Put(ctx, "done.pdf", strings.NewReader("done"), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	files := map[string]time.Time{
+		"stale.pdf" + partialMarker + "1":         old,
+		"claimed.pdf" + partialMarker + "claimed": old,
+		"fresh.pdf" + partialMarker + "2":         time.Now(),
+	}
+	for name, modTime := range files {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte("half"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Finished objects are never partials, however old
+	if err := os.Chtimes(filepath.Join(root, "done.pdf"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := storage.RemovePartials(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("RemovePartials() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("RemovePartials() = %d, want 2", removed)
+	}
+	want := []string{"done.pdf", "fresh.pdf" + partialMarker + "2"}
+	if names := dirNames(t, root); strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("files after RemovePartials() = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps objects in memory. It suits tests and single instance setups
+// where generated files don't need to survive a restart.
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+// memoryObject is the content of a stored object
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// memoryObjectReader makes the object content closable while keeping it seekable
+type memoryObjectReader struct {
+	*bytes.Reader
+}
+
+// Close does nothing, the content stays in memory
+func (memoryObjectReader) Close() error {
+	return nil
+}
+
+// NewMemoryStorage creates an empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		objects: make(map[string]memoryObject),
+	}
+}
+
+// Put reads the object into memory
+func (s *MemoryStorage) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	if err := validateObjectName(name); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.objects[name] = memoryObject{data: data, modTime: time.Now()}
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns a reader over the object content
+func (s *MemoryStorage) Get(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	s.mu.RLock()
+	object, ok := s.objects[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ObjectInfo{}, ErrObjectNotFound
+	}
+
+	// Stored content is never modified, so readers can share it
+	return memoryObjectReader{bytes.NewReader(object.data)}, object.info(name), nil
+}
+
+// Claim removes the object and returns a reader over its content
+func (s *MemoryStorage) Claim(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	s.mu.Lock()
+	object, ok := s.objects[name]
+	delete(s.objects, name)
+	s.mu.Unlock()
+	if !ok {
+		return nil, ObjectInfo{}, ErrObjectNotFound
+	}
+	return memoryObjectReader{bytes.NewReader(object.data)}, object.info(name), nil
+}
+
+// Delete removes the object
+func (s *MemoryStorage) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	delete(s.objects, name)
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns the objects whose names start with prefix, sorted by name
+func (s *MemoryStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var objects []ObjectInfo
+	for name, object := range s.objects {
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, object.info(name))
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Name < objects[j].Name
+	})
+	return objects, nil
+}
+
+// Stat returns the size and modification time of the object
+func (s *MemoryStorage) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	s.mu.RLock()
+	object, ok := s.objects[name]
+	s.mu.RUnlock()
+	if !ok {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return object.info(name), nil
+}
+
+// info describes the object stored under name
+func (o memoryObject) info(name string) ObjectInfo {
+	return ObjectInfo{Name: name, Size: int64(len(o.data)), ModTime: o.modTime}
+}
@@ -0,0 +1,462 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"img-to-pdf-converter/internal/config"
+	"img-to-pdf-converter/internal/tracing"
+)
+
+// s3UnsignedPayload marks request bodies that are not part of the signature, so uploads can be streamed
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Storage stores objects in a bucket of an S3-compatible service such as AWS S3 or MinIO.
+// Requests use path-style addressing and are signed with AWS Signature Version 4.
+type S3Storage struct {
+	endpoint   *url.URL
+	region     string
+	bucket     string
+	prefix     string
+	accessKey  string
+	secretKey  string
+	timeout    time.Duration
+	httpClient *http.Client
+}
+
+// errS3PreconditionFailed is returned when a conditional request doesn't match the object
+var errS3PreconditionFailed = errors.New("S3 precondition failed")
+
+// ErrConditionalDeleteUnsupported is returned when the S3 service deletes objects regardless of If-Match
+var ErrConditionalDeleteUnsupported = errors.New("S3 service ignores If-Match on DELETE, one-time downloads could be served twice")
+
+// s3ListResult is the response body of a ListObjectsV2 request
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// s3Error is the response body of a failed request
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// NewS3Storage creates a storage for the configured bucket
+func NewS3Storage(cfg config.StorageConfig) (*S3Storage, error) {
+	if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+		return nil, fmt.Errorf("S3 storage needs S3_ENDPOINT and S3_BUCKET")
+	}
+	if cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+		return nil, fmt.Errorf("S3 storage needs S3_ACCESS_KEY and S3_SECRET_KEY")
+	}
+
+	endpoint, err := url.Parse(cfg.S3Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %s", cfg.S3Endpoint)
+	}
+
+	// Downloads are streamed from S3 to the client, so the timeout covers connecting and waiting
+	// for the response headers but not reading the body, which the request context bounds instead
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: cfg.S3Timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = cfg.S3Timeout
+	transport.ResponseHeaderTimeout = cfg.S3Timeout
+
+	return &S3Storage{
+		endpoint:   endpoint,
+		region:     cfg.S3Region,
+		bucket:     cfg.S3Bucket,
+		prefix:     cfg.S3Prefix,
+		accessKey:  cfg.S3AccessKey,
+		secretKey:  cfg.S3SecretKey,
+		timeout:    cfg.S3Timeout,
+		httpClient: &http.Client{Transport: &tracing.Transport{Base: transport, Propagate: true}},
+	}, nil
+}
+
+// Put uploads the object in a single PUT request
+func (s *S3Storage) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	if err := validateObjectName(name); err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, name, nil, r)
+	if err != nil {
+		return err
+	}
+	// S3 rejects uploads without a length
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get downloads the object. The returned reader is not seekable.
+func (s *S3Storage) Get(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	if err := validateObjectName(name); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return resp.Body, s.objectInfo(name, resp), nil
+}
+
+// Claim downloads the object and deletes it on condition that its ETag is still the downloaded one,
+// so only one of several concurrent claims succeeds. The S3 service must support conditional deletes.
+func (s *S3Storage) Claim(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	if err := validateObjectName(name); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		resp.Body.Close()
+		return nil, ObjectInfo{}, fmt.Errorf("S3 GET %s returned no ETag", req.URL.Path)
+	}
+
+	deleteCtx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	deleteReq, err := s.newRequest(deleteCtx, http.MethodDelete, name, nil, nil)
+	if err != nil {
+		resp.Body.Close()
+		return nil, ObjectInfo{}, err
+	}
+	deleteReq.Header.Set("If-Match", etag)
+	deleteResp, err := s.do(deleteReq)
+	if err != nil {
+		resp.Body.Close()
+		// Another claim deleted or replaced the object in the meantime
+		if errors.Is(err, errS3PreconditionFailed) {
+			return nil, ObjectInfo{}, ErrObjectNotFound
+		}
+		return nil, ObjectInfo{}, err
+	}
+	deleteResp.Body.Close()
+
+	return resp.Body, s.objectInfo(name, resp), nil
+}
+
+// CheckConditionalDelete stores a probe object and deletes it with an If-Match that doesn't hold,
+// which must be refused for claims to be exclusive. The probe is removed in any case.
+func (s *S3Storage) CheckConditionalDelete(ctx context.Context) error {
+	// A partial name keeps the probe out of listings and downloads
+	name := "conditional-delete-check" + partialMarker + strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := s.Put(ctx, name, strings.NewReader("probe"), 5); err != nil {
+		return err
+	}
+	defer s.Delete(context.WithoutCancel(ctx), name)
+
+	deleteCtx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	req, err := s.newRequest(deleteCtx, http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("If-Match", `"00000000000000000000000000000000"`)
+	resp, err := s.do(req)
+	if errors.Is(err, errS3PreconditionFailed) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return ErrConditionalDeleteUnsupported
+}
+
+// Delete removes the object, S3 reports success for missing objects as well
+func (s *S3Storage) Delete(ctx context.Context, name string) error {
+	if err := validateObjectName(name); err != nil {
+		return err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	req, err := s.newRequest(ctx, http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List returns the objects whose names start with prefix, following continuation tokens
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var objects []ObjectInfo
+	token := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {s.prefix + prefix},
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := s.newRequest(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 list response: %v", err)
+		}
+
+		for _, content := range result.Contents {
+			name := strings.TrimPrefix(content.Key, s.prefix)
+			// Keys in "subdirectories" of the prefix don't belong to this storage
+			if strings.Contains(name, "/") {
+				continue
+			}
+			objects = append(objects, ObjectInfo{Name: name, Size: content.Size, ModTime: content.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Stat fetches the object metadata with a HEAD request
+func (s *S3Storage) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	if err := validateObjectName(name); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	req, err := s.newRequest(ctx, http.MethodHead, name, nil, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+	return s.objectInfo(name, resp), nil
+}
+
+// withTimeout bounds requests whose response bodies are small, so a stalled endpoint can't hang them
+func (s *S3Storage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// newRequest builds a request for an object, or for the bucket when name is empty
+func (s *S3Storage) newRequest(ctx context.Context, method, name string, query url.Values, body io.Reader) (*http.Request, error) {
+	target := *s.endpoint
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + s.bucket
+	if name != "" {
+		target.Path += "/" + s.prefix + name
+	}
+	target.RawPath = s3EncodePath(target.Path)
+	target.RawQuery = s3CanonicalQuery(query)
+
+	return http.NewRequestWithContext(ctx, method, target.String(), body)
+}
+
+// do signs and sends the request, turning error responses into errors
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	s.sign(req, time.Now().UTC())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 request failed: %v", err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return nil, errS3PreconditionFailed
+	}
+
+	var s3Err s3Error
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if xml.Unmarshal(data, &s3Err) == nil && s3Err.Code != "" {
+		return nil, fmt.Errorf("S3 %s %s failed: %s: %s", req.Method, req.URL.Path, s3Err.Code, s3Err.Message)
+	}
+	return nil, fmt.Errorf("S3 %s %s failed with status %d", req.Method, req.URL.Path, resp.StatusCode)
+}
+
+// sign adds the AWS Signature Version 4 headers to the request
+func (s *S3Storage) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	// Bodies are streamed unsigned unless the caller already set their hash
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = s3UnsignedPayload
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// Host and the x-amz-* headers are signed, in lowercase and sorted order
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// objectInfo reads the object metadata from the response headers
+func (s *S3Storage) objectInfo(name string, resp *http.Response) ObjectInfo {
+	info := ObjectInfo{Name: name, Size: resp.ContentLength}
+	if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		info.Size = size
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+	return info
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EncodePath percent-encodes every path segment as required by Signature Version 4
+func s3EncodePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3CanonicalQuery encodes the query with sorted keys and strict percent-encoding
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3Escape(key)+"="+s3Escape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything except the unreserved characters of RFC 3986
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"syscall"
+	"time"
+
+	"img-to-pdf-converter/internal/config"
+	"img-to-pdf-converter/internal/tracing"
+	"img-to-pdf-converter/internal/utils"
+)
+
+// Errors of URL fetches, wrapped with the URL so handlers can tell the client's mistakes from failing servers
+var (
+	ErrBlockedAddress = errors.New("blocked address")    // The URL resolves to an address the server must not reach
+	ErrFetchFailed    = errors.New("failed to fetch")    // The server of the URL is unreachable or didn't send the image
+	ErrFetchTimeout   = errors.New("timed out fetching") // The server of the URL didn't answer within the fetch timeout
+)
+
+// blockedPrefixes are non-public ranges that netip has no predicate for
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "This network", reaches the local host on Linux
+	netip.MustParsePrefix("100.64.0.0/10"),  // Carrier-grade NAT
+	netip.MustParsePrefix("198.18.0.0/15"),  // Benchmarking, used for internal networks
+	netip.MustParsePrefix("240.0.0.0/4"),    // Reserved
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, embeds any IPv4 address such as 127.0.0.1 or 10.0.0.1
+	netip.MustParsePrefix("64:ff9b:1::/48"), // Local-use NAT64
+}
+
+// addressGuard reports whether connecting to addr must be refused
+type addressGuard func(addr netip.Addr) bool
+
+// newFetchClient creates the HTTP client used to download images from URLs.
+// Unless private networks are allowed, every connection is checked after DNS resolution,
+// so redirects and rebinding can't be used to reach internal services.
+func newFetchClient(cfg *config.Config) *http.Client {
+	var guard addressGuard
+	if !cfg.Fetch.AllowPrivateNetworks {
+		guard = isBlockedAddress
+	}
+	return newGuardedFetchClient(cfg, guard)
+}
+
+// newGuardedFetchClient creates a fetch client that refuses connections to the addresses
+// blocked by guard. Without a guard every address can be reached.
+func newGuardedFetchClient(cfg *config.Config, guard addressGuard) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: cfg.Fetch.Timeout,
+	}
+	if guard != nil {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if guard(addr) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+			}
+			return nil
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil, // A proxy would hide the real destination from the address check
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.Fetch.Timeout,
+		ResponseHeaderTimeout: cfg.Fetch.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &http.Client{
+		// Fetches show up in the request's trace, but fetched URLs are third parties, so it isn't passed on
+		Transport: &tracing.Transport{Base: transport},
+		Timeout:   cfg.Fetch.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.Fetch.MaxRedirects {
+				return fmt.Errorf("too many redirects (max: %d)", cfg.Fetch.MaxRedirects)
+			}
+			return validateFetchURL(req.URL)
+		},
+	}
+}
+
+// fetchError tells a fetch cut off by the request context or the fetch timeout from a failing server
+func fetchError(ctx context.Context, rawURL string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("fetching %s stopped: %w", rawURL, ctxErr)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w %s", ErrFetchTimeout, rawURL)
+	}
+	return fmt.Errorf("%w %s: %v", ErrFetchFailed, rawURL, err)
+}
+
+// isBlockedAddress checks for loopback, private, link-local and other non-public addresses
+func isBlockedAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFetchURL only allows absolute http and https URLs
+func validateFetchURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme: %s", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("URL has no host")
+	}
+	return nil
+}
+
+// FetchURLs downloads the images at the given URLs, in order, and returns them as conversion inputs.
+// The content type is sniffed from the downloaded bytes, the type claimed by the server is ignored.
+// Together the downloads may not exceed the maximum request size, so they are never all held in memory at full size.
+func (s *FileService) FetchURLs(ctx context.Context, urls []string) ([]ImageInput, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no URLs provided")
+	}
+	if len(urls) > s.config.Upload.MaxFiles {
+		return nil, fmt.Errorf("too many URLs: %d (max: %d)", len(urls), s.config.Upload.MaxFiles)
+	}
+
+	files := make([]ImageInput, 0, len(urls))
+	remaining := s.config.Upload.MaxRequestSize
+	for i, rawURL := range urls {
+		file, err := s.fetchURL(ctx, rawURL, i, remaining)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		remaining -= file.Size()
+	}
+
+	return files, nil
+}
+
+// fetchURL downloads a single URL while enforcing the per-file size limit and the bytes
+// remaining of the request limit
+func (s *FileService) fetchURL(ctx context.Context, rawURL string, index int, remaining int64) (*MemoryInput, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %v", rawURL, err)
+	}
+	if err := validateFetchURL(u); err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %v", rawURL, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %v", rawURL, err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlockedAddress) {
+			return nil, fmt.Errorf("URL %s points to a %w", rawURL, ErrBlockedAddress)
+		}
+		return nil, fetchError(ctx, rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w %s: status %d", ErrFetchFailed, rawURL, resp.StatusCode)
+	}
+
+	// The type is only known once the content is read, the per-type limit is checked by ValidateFile
+	maxSize := s.config.Upload.LargestFileSize()
+	tooLarge := fmt.Errorf("file at %s is too large (max: %d bytes)", rawURL, maxSize)
+	if remaining < maxSize {
+		maxSize = remaining
+		tooLarge = fmt.Errorf("URLs exceed the upload limit of %d bytes at %s", s.config.Upload.MaxRequestSize, rawURL)
+	}
+	if resp.ContentLength > maxSize {
+		return nil, tooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fetchError(ctx, rawURL, err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, tooLarge
+	}
+
+	name := utils.SanitizeFilename(path.Base(resp.Request.URL.Path))
+	if name == "" || name == "." || name == "/" {
+		name = fmt.Sprintf("image_%d", index+1)
+	}
+
+	slog.DebugContext(ctx, "Fetched URL", "url", rawURL, "bytes", len(data))
+	return NewMemoryInput(name, http.DetectContentType(data), data), nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"img-to-pdf-converter/internal/tracing"
+)
+
+func TestIsBlockedAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"198.18.0.1", true},
+		{"198.19.255.255", true},
+		{"240.0.0.1", true},
+		{"224.0.0.1", true},
+		{"::1", true},
+		{"fe80::1", true},
+		{"fc00::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"64:ff9b::7f00:1", true},
+		{"64:ff9b::a00:1", true},
+		{"64:ff9b:1::1", true},
+		{"8.8.8.8", false},
+		{"198.20.0.1", false},
+		{"2001:4860:4860::8888", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := isBlockedAddress(netip.MustParseAddr(tt.addr)); got != tt.blocked {
+				t.Errorf("isBlockedAddress(%s) = %v, want %v", tt.addr, got, tt.blocked)
+			}
+		})
+	}
+}
+
+// newTestServer starts an HTTP server listening on the given loopback address
+func newTestServer(t *testing.T, addr string, handler http.Handler) *httptest.Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", addr+":0")
+	if err != nil {
+		t.Skipf("can't listen on %s: %v", addr, err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// blockSecondLoopback stands in for a public/private split on a single host:
+// 127.0.0.1 plays a public server and 127.0.0.2 an internal one
+func blockSecondLoopback(addr netip.Addr) bool {
+	return addr == netip.MustParseAddr("127.0.0.2")
+}
+
+func TestFetchURLs(t *testing.T) {
+	image := testPNG(t, 4, 4)
+	internal := newTestServer(t, "127.0.0.2", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(image)
+	}))
+	public := newTestServer(t, "127.0.0.1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Header().Set("Content-Type", "text/plain") // Ignored, the type is sniffed
+			w.Write(image)
+		case "/large":
+			w.Write(make([]byte, 600))
+		case "/redirect-internal":
+			http.Redirect(w, r, internal.URL+"/secret", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(public.URL, "http://"))
+
+	tests := []struct {
+		name           string
+		urls           []string
+		guard          addressGuard
+		maxRequestSize int64
+		wantErr        string
+	}{
+		{name: "public server", urls: []string{public.URL + "/image.png"}, guard: blockSecondLoopback},
+		{name: "loopback blocked", urls: []string{public.URL + "/image.png"}, guard: isBlockedAddress, wantErr: "blocked address"},
+		{name: "private server blocked", urls: []string{internal.URL + "/secret"}, guard: blockSecondLoopback, wantErr: "blocked address"},
+		{name: "redirect to private server", urls: []string{public.URL + "/redirect-internal"}, guard: blockSecondLoopback, wantErr: "blocked address"},
+		// The check runs on the address actually dialed, so a name resolving to an internal address is caught
+		// however it resolved when the URL was checked
+		{name: "name resolving to loopback", urls: []string{"http://localhost:" + port + "/image.png"}, guard: isBlockedAddress, wantErr: "blocked address"},
+		{name: "too many redirects", urls: []string{public.URL + "/loop"}, guard: blockSecondLoopback, wantErr: "too many redirects"},
+		{name: "unsupported scheme", urls: []string{"file:///etc/passwd"}, guard: blockSecondLoopback, wantErr: "unsupported URL scheme"},
+		{name: "not found", urls: []string{public.URL + "/missing"}, guard: blockSecondLoopback, wantErr: "status 404"},
+		{
+			name:           "request size budget",
+			urls:           []string{public.URL + "/large", public.URL + "/large"},
+			guard:          blockSecondLoopback,
+			maxRequestSize: 1000,
+			wantErr:        "exceed the upload limit of 1000 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			if tt.maxRequestSize > 0 {
+				cfg.Upload.MaxRequestSize = tt.maxRequestSize
+			}
+			s := NewFileService(cfg)
+			s.httpClient = newGuardedFetchClient(cfg, tt.guard)
+
+			files, err := s.FetchURLs(context.Background(), tt.urls)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("FetchURLs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchURLs() error = %v", err)
+			}
+			if len(files) != 1 || files[0].ContentType() != "image/png" || files[0].Name() != "image.png" {
+				t.Errorf("FetchURLs() = %+v, want image.png sniffed as image/png", files)
+			}
+		})
+	}
+}
+
+func TestNewFetchClientAllowPrivateNetworks(t *testing.T) {
+	server := newTestServer(t, "127.0.0.1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testPNG(t, 1, 1))
+	}))
+
+	for _, allow := range []bool{false, true} {
+		cfg := testConfig(t)
+		cfg.Fetch.AllowPrivateNetworks = allow
+		_, err := NewFileService(cfg).FetchURLs(context.Background(), []string{server.URL + "/a.png"})
+		if allow && err != nil {
+			t.Errorf("FetchURLs() with private networks allowed: error = %v", err)
+		}
+		if !allow && (err == nil || !strings.Contains(err.Error(), "blocked address")) {
+			t.Errorf("FetchURLs() with private networks blocked: error = %v, want blocked address", err)
+		}
+	}
+}
+
+func TestFetchURLsTracesWithoutPropagation(t *testing.T) {
+	exporter := withTestTracer(t)
+	traceparent := "unset"
+	server := newTestServer(t, "127.0.0.1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write(testPNG(t, 1, 1))
+	}))
+
+	cfg := testConfig(t)
+	s := NewFileService(cfg)
+	s.httpClient = newGuardedFetchClient(cfg, nil)
+
+	ctx, span := tracing.Start(context.Background(), "test")
+	_, err := s.FetchURLs(ctx, []string{server.URL + "/a.png"})
+	span.End()
+	if err != nil {
+		t.Fatalf("FetchURLs() error = %v", err)
+	}
+
+	// The fetched server is a third party and doesn't learn our trace IDs
+	if traceparent != "" {
+		t.Errorf("traceparent = %q sent to the fetched server", traceparent)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "GET" || spans[0].Parent.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("spans = %v, want a GET client span under the caller's span", spans)
+	}
+}
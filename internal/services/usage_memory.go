@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryUsageStore keeps usage counters in memory. Counters are lost on restart and
+// not shared between replicas, so every replica enforces the quotas on its own.
+type MemoryUsageStore struct {
+	mu    sync.Mutex
+	day   string
+	usage map[string]Usage
+}
+
+// NewMemoryUsageStore creates an empty usage store
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{
+		usage: make(map[string]Usage),
+	}
+}
+
+// Get returns the usage of key on day
+func (s *MemoryUsageStore) Get(ctx context.Context, key, day string) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if day != s.day {
+		return Usage{}, nil
+	}
+	return s.usage[key], nil
+}
+
+// Add adds usage to the counters of key on day. Only the current day is kept, the counters
+// of earlier days are dropped once a new day starts and later changes to them are ignored.
+func (s *MemoryUsageStore) Add(ctx context.Context, key, day string, usage Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.useDay(day) {
+		return nil
+	}
+	s.usage[key] = addUsage(s.usage[key], usage)
+	return nil
+}
+
+// Reserve adds usage to the counters of key on day if they stay within limits
+func (s *MemoryUsageStore) Reserve(ctx context.Context, key, day string, usage, limits Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.useDay(day) {
+		return nil
+	}
+	total := s.usage[key]
+	if usage.Conversions > 0 && limits.Conversions > 0 && total.Conversions+usage.Conversions > limits.Conversions {
+		return ErrQuotaExceeded
+	}
+	if usage.Bytes > 0 && limits.Bytes > 0 && total.Bytes+usage.Bytes > limits.Bytes {
+		return ErrQuotaExceeded
+	}
+	s.usage[key] = addUsage(total, usage)
+	return nil
+}
+
+// useDay switches the counters to day when it is a new day and reports whether day is current
+func (s *MemoryUsageStore) useDay(day string) bool {
+	// Days are formatted as "2006-01-02", so they sort by date
+	if day < s.day {
+		return false
+	}
+	if day != s.day {
+		s.day = day
+		s.usage = make(map[string]Usage)
+	}
+	return true
+}
+
+// addUsage returns the sum of two usages
+func addUsage(a, b Usage) Usage {
+	return Usage{Conversions: a.Conversions + b.Conversions, Bytes: a.Bytes + b.Bytes}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestMemoryUsageStoreReserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		used    Usage
+		reserve Usage
+		limits  Usage
+		wantErr error
+		want    Usage
+	}{
+		{"within limits", Usage{Conversions: 1, Bytes: 10}, Usage{Conversions: 1, Bytes: 10}, Usage{Conversions: 2, Bytes: 20}, nil, Usage{Conversions: 2, Bytes: 20}},
+		{"unlimited", Usage{Conversions: 100, Bytes: 1000}, Usage{Conversions: 1, Bytes: 10}, Usage{}, nil, Usage{Conversions: 101, Bytes: 1010}},
+		{"no conversions left", Usage{Conversions: 2}, Usage{Conversions: 1}, Usage{Conversions: 2}, ErrQuotaExceeded, Usage{Conversions: 2}},
+		{"several documents over the limit", Usage{Conversions: 1}, Usage{Conversions: 3}, Usage{Conversions: 3}, ErrQuotaExceeded, Usage{Conversions: 1}},
+		{"request over the bytes", Usage{Bytes: 15}, Usage{Conversions: 1, Bytes: 10}, Usage{Bytes: 20}, ErrQuotaExceeded, Usage{Bytes: 15}},
+		{"more conversions with bytes used up", Usage{Conversions: 1, Bytes: 20}, Usage{Conversions: 1}, Usage{Conversions: 5, Bytes: 20}, nil, Usage{Conversions: 2, Bytes: 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryUsageStore()
+			store.Add(ctx, "acme", "2024-05-01", tt.used)
+
+			if err := store.Reserve(ctx, "acme", "2024-05-01", tt.reserve, tt.limits); err != tt.wantErr {
+				t.Errorf("Reserve() error = %v, want %v", err, tt.wantErr)
+			}
+			if got, _ := store.Get(ctx, "acme", "2024-05-01"); got != tt.want {
+				t.Errorf("usage = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryUsageStoreConcurrentReserve(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryUsageStore()
+	limits := Usage{Conversions: 5}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if store.Reserve(ctx, "acme", "2024-05-01", Usage{Conversions: 1}, limits) == nil {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if granted != 5 {
+		t.Errorf("%d reservations granted, want 5", granted)
+	}
+}
+
+func TestMemoryUsageStoreDays(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryUsageStore()
+	store.Add(ctx, "acme", "2024-05-01", Usage{Conversions: 3})
+	store.Add(ctx, "acme", "2024-05-02", Usage{Conversions: 1})
+
+	// A refund for a request that started yesterday must not touch today's counters
+	store.Add(ctx, "acme", "2024-05-01", Usage{Conversions: -3})
+
+	if got, _ := store.Get(ctx, "acme", "2024-05-02"); got.Conversions != 1 {
+		t.Errorf("conversions today = %d, want 1", got.Conversions)
+	}
+	if got, _ := store.Get(ctx, "acme", "2024-05-01"); got.Conversions != 0 {
+		t.Errorf("conversions of a dropped day = %d, want 0", got.Conversions)
+	}
+}
@@ -0,0 +1,109 @@
+// Package tracing sets up OpenTelemetry tracing for the service, so slow uploads can be broken
+// down into upload, validation, preprocessing and PDF generation. Spans are batched and sent to
+// an OTLP/HTTP collector or, by default, not recorded at all.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"img-to-pdf-converter/internal/config"
+)
+
+// scopeName identifies this service's instrumentation in exported spans
+const scopeName = "img-to-pdf-converter"
+
+// New creates the tracer provider selected by the configuration, nil when tracing is disabled.
+// Requests continuing a trace are sampled when their caller sampled it, new traces always are.
+func New(cfg *config.Config) (*sdktrace.TracerProvider, error) {
+	switch cfg.Tracing.Exporter {
+	case "", "none":
+		return nil, nil
+	case "otlp":
+	default:
+		return nil, fmt.Errorf("unsupported traces exporter: %s", cfg.Tracing.Exporter)
+	}
+
+	endpoint := cfg.Tracing.Endpoint
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %s", endpoint)
+	}
+	headers := make(map[string]string, len(cfg.Tracing.Headers))
+	for _, header := range cfg.Tracing.Headers {
+		key, value, ok := strings.Cut(header, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid OTLP header: %s", header)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	// Creating the exporter doesn't connect, an unreachable collector only fails the exports
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(endpoint),
+		otlptracehttp.WithHeaders(headers))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", cfg.Tracing.ServiceName),
+		attribute.String("service.version", cfg.App.Version)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracing resource: %v", err)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	), nil
+}
+
+// SetTracerProvider makes provider the global tracer provider, unless it is nil, and installs
+// the W3C trace context propagator, so traces are continued from and passed on to other services
+func SetTracerProvider(provider *sdktrace.TracerProvider) {
+	if provider != nil {
+		otel.SetTracerProvider(provider)
+	}
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// Start begins a span as a child of the current span of ctx with the global tracer provider.
+// Without a provider the span is not recorded.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(scopeName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End marks the span as failed when err is not nil and ends it
+func End(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
+
+// RecordError records err on the span and sets its status to error. A nil error is ignored.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// TraceID returns the ID of the trace of the current span of ctx, empty when it isn't recorded
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsSampled() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transport wraps an HTTP transport so every outgoing request gets a client span, and with
+// Propagate carries the trace context in a traceparent header. The span ends when the response
+// headers arrive.
+type Transport struct {
+	Base      http.RoundTripper // Sends the requests, http.DefaultTransport when nil
+	Propagate bool              // Only for our own backends, a traceparent tells third parties our trace IDs
+}
+
+// RoundTrip sends the request within a client span
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// Only the host is recorded, paths and queries of fetched URLs may hold credentials
+	ctx, span := otel.Tracer(scopeName).Start(req.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Hostname())))
+	defer span.End()
+
+	if t.Propagate {
+		// Requests must not be modified by a transport, the header goes on a copy
+		req = req.Clone(ctx)
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		RecordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		RecordError(span, fmt.Errorf("server responded with %s", resp.Status))
+	}
+	return resp, nil
+}
@@ -8,6 +8,7 @@ import (
 	_ "image/png"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -71,3 +72,55 @@ func GetFileSize(filepath string) (int64, error) {
 	}
 	return info.Size(), nil
 }
+
+// NaturalLess compares two filenames in natural order, so "scan2.jpg" sorts before "scan10.jpg"
+func NaturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			// Compare whole digit runs numerically, ignoring leading zeros
+			numA, restA := splitDigits(a)
+			numB, restB := splitDigits(b)
+			trimmedA, trimmedB := strings.TrimLeft(numA, "0"), strings.TrimLeft(numB, "0")
+			if len(trimmedA) != len(trimmedB) {
+				return len(trimmedA) < len(trimmedB)
+			}
+			if trimmedA != trimmedB {
+				return trimmedA < trimmedB
+			}
+			if len(numA) != len(numB) {
+				return len(numA) < len(numB)
+			}
+			a, b = restA, restB
+			continue
+		}
+
+		charA, charB := toLowerASCII(a[0]), toLowerASCII(b[0])
+		if charA != charB {
+			return charA < charB
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// isDigit checks if a byte is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// toLowerASCII lowercases ASCII letters and leaves other bytes untouched
+func toLowerASCII(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
+// splitDigits splits s into its leading run of digits and the remainder
+func splitDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"scan2.png", "scan10.png", true},
+		{"scan10.png", "scan2.png", false},
+		{"Scan1.png", "scan2.png", true},
+		{"page.png", "Page.png", false},
+		{"scan2.png", "scan02.png", true},
+		{"scan02.png", "scan2.png", false},
+		{"scan007.png", "scan7a.png", false},
+		{"a", "ab", true},
+		{"10", "9", false},
+		{"img", "img", false},
+	}
+
+	for _, tt := range tests {
+		if got := NaturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("NaturalLess(%q, %q) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+// Package converter turns images and PDF documents into a single PDF, a multipage TIFF
+// or a ZIP archive of normalised PNG pages. It has no HTTP dependencies, so it can be
+// embedded in other Go programs as well as serve the API handlers.
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+)
+
+// Supported output formats
+const (
+	FormatPDF  = "pdf"
+	FormatTIFF = "tiff"
+	FormatZIP  = "zip"
+)
+
+// PDFContentType is the MIME type of PDF documents, whose pages are merged into the output
+const PDFContentType = "application/pdf"
+
+// ErrNoSources is returned when Convert is called without any sources
+var ErrNoSources = errors.New("no sources provided")
+
+// ErrNoPages is returned when none of the sources could be converted into a page
+var ErrNoPages = errors.New("no pages could be converted")
+
+// ErrTooManyPages is returned as soon as the output exceeds Options.MaxPages
+var ErrTooManyPages = errors.New("too many pages")
+
+// ErrPageTooLarge is returned before rendering a PDF page that would exceed Options.MaxPagePixels
+var ErrPageTooLarge = errors.New("rendered page too large")
+
+// ImageSource is an input document. The reader is consumed once, in source order.
+type ImageSource struct {
+	Name        string    // Original filename, used in the report
+	ContentType string    // MIME type, sniffed from the content when empty
+	Reader      io.Reader // Image or PDF data
+}
+
+// Options holds the conversion parameters
+type Options struct {
+	Fit           bool       // Scale small images up to the usable page area
+	Position      string     // Image position on the page, e.g. "center" or "top-left"
+	Orientation   string     // Page orientation: "P" (portrait, default) or "L" (landscape)
+	PageSize      string     // Page size of PDF output: "A4" (default), "A3", "A5", "Letter" or "Legal"
+	Format        string     // Output format: pdf (default), tiff or zip
+	DPI           int        // Resolution of TIFF pages and rendered PDF pages, 150 by default
+	Rasterizer    Rasterizer // Renders PDF sources for TIFF and ZIP output
+	TempDir       string     // Parent directory for scratch files, the system default when empty
+	MaxSourceSize int64      // Maximum size of a single source in bytes, unlimited when zero
+	MaxPages      int        // Maximum number of output pages, unlimited when zero
+	MaxPagePixels float64    // Maximum pixels of a rendered PDF page, unlimited when zero
+	Tracer        Tracer     // Told about each conversion step, optional
+}
+
+// Tracer is told about the steps of a conversion, such as embedding an image or writing the
+// output, e.g. to record them as tracing spans
+type Tracer interface {
+	// StartStep is called when a step begins. The returned function is called with the
+	// step's error, nil on success, when it ends.
+	StartStep(ctx context.Context, name string, attrs map[string]any) (end func(err error))
+}
+
+// Report describes the result of a conversion
+type Report struct {
+	Format  string         // Output format that was written
+	Pages   int            // Number of pages in the output
+	Sources []SourceReport // One entry per source, in source order
+}
+
+// SourceReport describes how a single source was converted
+type SourceReport struct {
+	Name        string
+	ContentType string
+	Size        int64  // Bytes read from the source
+	Pages       int    // Pages the source contributed to the output
+	Skipped     bool   // The source could not be decoded and was left out
+	Reason      string // Why the source was skipped
+}
+
+// IsValidFormat checks if the output format is supported
+func IsValidFormat(format string) bool {
+	switch format {
+	case FormatPDF, FormatTIFF, FormatZIP:
+		return true
+	}
+	return false
+}
+
+// ContentType returns the MIME type of an output format
+func ContentType(format string) string {
+	switch format {
+	case FormatTIFF:
+		return "image/tiff"
+	case FormatZIP:
+		return "application/zip"
+	}
+	return PDFContentType
+}
+
+// Convert converts the sources, in order, into a single document written to w.
+// Images that can't be decoded are skipped and listed in the report, other failures abort the conversion.
+// Nothing is written to w before all sources have been processed successfully for PDF output.
+func Convert(ctx context.Context, sources []ImageSource, opts Options, w io.Writer) (Report, error) {
+	opts = withDefaults(opts)
+	report := Report{Format: opts.Format}
+
+	if len(sources) == 0 {
+		return report, ErrNoSources
+	}
+	if !IsValidFormat(opts.Format) {
+		return report, fmt.Errorf("unsupported output format: %s", opts.Format)
+	}
+	if !IsValidPageSize(opts.PageSize) {
+		return report, fmt.Errorf("unsupported page size: %s", opts.PageSize)
+	}
+
+	if opts.TempDir != "" {
+		if err := os.MkdirAll(opts.TempDir, 0755); err != nil {
+			return report, fmt.Errorf("failed to create temp directory: %v", err)
+		}
+	}
+	tempDir, err := os.MkdirTemp(opts.TempDir, "conversion_*")
+	if err != nil {
+		return report, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	c := &conversion{
+		ctx:     ctx,
+		opts:    opts,
+		tempDir: tempDir,
+		report:  &report,
+	}
+
+	switch opts.Format {
+	case FormatTIFF:
+		err = c.writeTIFF(sources, w)
+	case FormatZIP:
+		err = c.writeZIP(sources, w)
+	default:
+		err = c.writePDF(sources, w)
+	}
+
+	return report, err
+}
+
+// withDefaults fills in the defaults for empty options
+func withDefaults(opts Options) Options {
+	if opts.Format == "" {
+		opts.Format = FormatPDF
+	}
+	if opts.Orientation != "L" {
+		opts.Orientation = "P"
+	}
+	if opts.PageSize == "" {
+		opts.PageSize = "A4"
+	}
+	if opts.DPI <= 0 {
+		opts.DPI = 150
+	}
+	return opts
+}
+
+// conversion holds the state of a single Convert call
+type conversion struct {
+	ctx     context.Context
+	opts    Options
+	tempDir string
+	report  *Report
+}
+
+// startStep reports the start of a step to the tracer and returns the function ending it
+func (c *conversion) startStep(name string, attrs map[string]any) func(err error) {
+	if c.opts.Tracer == nil {
+		return func(error) {}
+	}
+	return c.opts.Tracer.StartStep(c.ctx, name, attrs)
+}
+
+// sourceAttrs describes a source for the tracer
+func sourceAttrs(index int, src ImageSource, contentType string, size int) map[string]any {
+	return map[string]any{
+		"source.index":        index,
+		"source.name":         src.Name,
+		"source.content_type": contentType,
+		"source.size":         size,
+	}
+}
+
+// readSource reads a source into memory, enforcing the size limit and sniffing the content type
+func (c *conversion) readSource(src ImageSource) ([]byte, string, error) {
+	reader := src.Reader
+	if c.opts.MaxSourceSize > 0 {
+		reader = io.LimitReader(reader, c.opts.MaxSourceSize+1)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %v", src.Name, err)
+	}
+	if c.opts.MaxSourceSize > 0 && int64(len(data)) > c.opts.MaxSourceSize {
+		return nil, "", fmt.Errorf("%s is too large (max: %d bytes)", src.Name, c.opts.MaxSourceSize)
+	}
+
+	contentType := src.ContentType
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return data, contentType, nil
+}
+
+// addSourceReport records a source in the report and returns it for updates
+func (c *conversion) addSourceReport(src ImageSource, contentType string, size int) *SourceReport {
+	c.report.Sources = append(c.report.Sources, SourceReport{
+		Name:        src.Name,
+		ContentType: contentType,
+		Size:        int64(size),
+	})
+	return &c.report.Sources[len(c.report.Sources)-1]
+}
+
+// skip marks a source as left out of the output
+func (r *SourceReport) skip(reason error) {
+	r.Skipped = true
+	r.Reason = reason.Error()
+}
+
+// writeTempFile stores data in the scratch directory for tools that need a file path
+func (c *conversion) writeTempFile(name string, data []byte) (string, error) {
+	path := filepath.Join(c.tempDir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write temp file: %v", err)
+	}
+	return path, nil
+}
+
+// forEachPageImage decodes the sources in order and calls fn for every page.
+// Pages are counted in the report before fn is called, those of a PDF before it is rendered.
+// Images are a single page, PDF documents are rendered page by page with the rasterizer.
+func (c *conversion) forEachPageImage(sources []ImageSource, fn func(img image.Image) error) error {
+	for i, src := range sources {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+
+		data, contentType, err := c.readSource(src)
+		if err != nil {
+			return err
+		}
+		sourceReport := c.addSourceReport(src, contentType, len(data))
+
+		if contentType != PDFContentType {
+			endStep := c.startStep("converter.decode_image", sourceAttrs(i, src, contentType, len(data)))
+			img, _, err := image.Decode(bytes.NewReader(data))
+			endStep(err)
+			if err != nil {
+				sourceReport.skip(fmt.Errorf("failed to decode image: %v", err))
+				continue
+			}
+			if err := c.reservePages(1); err != nil {
+				return err
+			}
+			if err := fn(img); err != nil {
+				return fmt.Errorf("failed to write page for %s: %v", src.Name, err)
+			}
+			sourceReport.Pages++
+			continue
+		}
+
+		if c.opts.Rasterizer == nil {
+			return fmt.Errorf("%s: PDF sources need a rasterizer for %s output", src.Name, c.opts.Format)
+		}
+		pdfPath, err := c.writeTempFile(fmt.Sprintf("source_%d.pdf", i), data)
+		if err != nil {
+			return err
+		}
+		// Rendering is the expensive part, so the pages are counted against the limit first
+		pageSizes, err := PDFPageSizes(pdfPath)
+		if err != nil {
+			return fmt.Errorf("failed to read PDF %s: %v", src.Name, err)
+		}
+		if err := c.reservePages(len(pageSizes)); err != nil {
+			return err
+		}
+		if err := c.checkPagePixels(src.Name, pageSizes); err != nil {
+			return err
+		}
+		renderDir := filepath.Join(c.tempDir, fmt.Sprintf("render_%d", i))
+		if err := os.MkdirAll(renderDir, 0755); err != nil {
+			return fmt.Errorf("failed to create temp directory: %v", err)
+		}
+
+		endStep := c.startStep("converter.rasterize", sourceAttrs(i, src, contentType, len(data)))
+		pages, err := c.opts.Rasterizer.Rasterize(c.ctx, pdfPath, renderDir, "png", c.opts.DPI)
+		endStep(err)
+		if err != nil {
+			return fmt.Errorf("failed to render PDF %s: %v", src.Name, err)
+		}
+		for _, page := range pages {
+			if err := c.ctx.Err(); err != nil {
+				return err
+			}
+			img, err := decodeImageFile(page)
+			if err != nil {
+				return fmt.Errorf("failed to decode rendered page %s: %v", filepath.Base(page), err)
+			}
+			if err := fn(img); err != nil {
+				return fmt.Errorf("failed to write page for %s: %v", src.Name, err)
+			}
+			sourceReport.Pages++
+		}
+	}
+
+	if c.report.Pages == 0 {
+		return ErrNoPages
+	}
+	return nil
+}
+
+// reservePages counts n more output pages, failing once the page limit would be exceeded
+func (c *conversion) reservePages(n int) error {
+	if c.opts.MaxPages > 0 && c.report.Pages+n > c.opts.MaxPages {
+		return ErrTooManyPages
+	}
+	c.report.Pages += n
+	return nil
+}
+
+// checkPagePixels fails when a page of a PDF source would be rendered with more pixels than allowed.
+// A page can declare a huge MediaBox in a few bytes, so this is checked before rendering.
+func (c *conversion) checkPagePixels(name string, pageSizes []PageSize) error {
+	if c.opts.MaxPagePixels <= 0 {
+		return nil
+	}
+	for i, size := range pageSizes {
+		if pixels := size.Pixels(c.opts.DPI); pixels > c.opts.MaxPagePixels {
+			return fmt.Errorf("%w: page %d of %s is %.1f megapixels at %d DPI (max: %g megapixels)",
+				ErrPageTooLarge, i+1, name, pixels/1e6, c.opts.DPI, c.opts.MaxPagePixels/1e6)
+		}
+	}
+	return nil
+}
+
+// decodeImageFile decodes the image file at path
+func decodeImageFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	return img, err
+}
@@ -0,0 +1,303 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/phpdave11/gofpdi"
+)
+
+// pointToMM converts PDF points to millimetres
+const pointToMM = 25.4 / 72
+
+// pdfImageTypes maps the image types gofpdf embeds natively to its type names.
+// Other formats are converted to PNG first.
+var pdfImageTypes = map[string]string{
+	"image/jpeg": "JPG",
+	"image/png":  "PNG",
+	"image/gif":  "GIF",
+}
+
+// margins defines page margins
+type margins struct {
+	Top, Right, Bottom, Left float64
+}
+
+// pageSizes are the portrait dimensions of the supported page sizes in millimetres, by lower case name
+var pageSizes = map[string]gofpdf.SizeType{
+	"a3":     {Wd: 297, Ht: 420},
+	"a4":     {Wd: 210, Ht: 297},
+	"a5":     {Wd: 148, Ht: 210},
+	"letter": {Wd: 215.9, Ht: 279.4},
+	"legal":  {Wd: 215.9, Ht: 355.6},
+}
+
+// IsValidPageSize checks if a page size such as "A4" or "Letter" is supported
+func IsValidPageSize(name string) bool {
+	_, ok := pageSizes[strings.ToLower(name)]
+	return ok
+}
+
+// pageMargins are the margins around images on the pages, in millimetres
+var pageMargins = margins{
+	Top:    10,
+	Right:  10,
+	Bottom: 10,
+	Left:   10,
+}
+
+// writePDF creates a PDF with one page per image, importing the pages of PDF sources in place
+func (c *conversion) writePDF(sources []ImageSource, w io.Writer) error {
+	orientation := c.opts.Orientation
+	size := pageSizes[strings.ToLower(c.opts.PageSize)]
+
+	// Create PDF with specified orientation
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{OrientationStr: orientation, UnitStr: "mm", Size: size})
+
+	// Calculate page dimensions based on orientation
+	pageW, pageH := size.Wd, size.Ht
+	if orientation == "L" {
+		pageW, pageH = pageH, pageW
+	}
+
+	// Calculate usable area
+	usableW := pageW - (pageMargins.Left + pageMargins.Right)
+	usableH := pageH - (pageMargins.Top + pageMargins.Bottom)
+
+	// Importer for pages of PDF sources
+	importer := gofpdi.NewImporter()
+
+	for i, src := range sources {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+
+		data, contentType, err := c.readSource(src)
+		if err != nil {
+			return err
+		}
+		sourceReport := c.addSourceReport(src, contentType, len(data))
+
+		// PDF sources are merged page by page instead of being embedded as an image
+		if contentType == PDFContentType {
+			pdfPath, err := c.writeTempFile(fmt.Sprintf("source_%d.pdf", i), data)
+			if err != nil {
+				return err
+			}
+			endStep := c.startStep("converter.import_pdf", sourceAttrs(i, src, contentType, len(data)))
+			pageCount, err := importPDFPages(pdf, importer, pdfPath, pageW, pageH, c.reservePages)
+			endStep(err)
+			if errors.Is(err, ErrTooManyPages) {
+				return err
+			}
+			if err != nil {
+				return fmt.Errorf("failed to import PDF %s: %v", src.Name, err)
+			}
+			sourceReport.Pages = pageCount
+			continue
+		}
+
+		imageName := fmt.Sprintf("source_%d", i)
+		endStep := c.startStep("converter.register_image", sourceAttrs(i, src, contentType, len(data)))
+		info, imageType, err := registerImage(pdf, imageName, data, contentType)
+		endStep(err)
+		if err != nil {
+			sourceReport.skip(err)
+			continue
+		}
+		if err := c.reservePages(1); err != nil {
+			return err
+		}
+
+		// Add new page with the document orientation, imported PDF pages may have changed it.
+		// gofpdf turns the portrait size for landscape pages itself.
+		pdf.AddPageFormat(orientation, size)
+
+		// Calculate new dimensions and position
+		imgW, imgH := info.Extent()
+		newW, newH := calculateOptimalDimensions(imgW, imgH, usableW, usableH, c.opts.Fit)
+		x, y := calculatePosition(c.opts.Position, usableW, usableH, newW, newH)
+		x += pageMargins.Left
+		y += pageMargins.Top
+
+		// Add image to PDF
+		pdf.ImageOptions(imageName, x, y, newW, newH, false, gofpdf.ImageOptions{ImageType: imageType}, 0, "")
+		sourceReport.Pages = 1
+	}
+
+	if c.report.Pages == 0 {
+		return ErrNoPages
+	}
+
+	endStep := c.startStep("converter.output", map[string]any{"pages": c.report.Pages})
+	err := pdf.Output(w)
+	endStep(err)
+	if err != nil {
+		return fmt.Errorf("failed to write PDF: %v", err)
+	}
+	return nil
+}
+
+// registerImage embeds an image in the document. Formats gofpdf can't read, and variants
+// it rejects such as interlaced PNGs, are decoded and embedded as PNG instead.
+func registerImage(pdf *gofpdf.Fpdf, name string, data []byte, contentType string) (*gofpdf.ImageInfoType, string, error) {
+	if imageType, ok := pdfImageTypes[contentType]; ok {
+		info := pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: imageType}, bytes.NewReader(data))
+		if !pdf.Err() {
+			return info, imageType, nil
+		}
+		pdf.ClearError()
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %v", err)
+	}
+	var converted bytes.Buffer
+	if err := png.Encode(&converted, img); err != nil {
+		return nil, "", fmt.Errorf("failed to convert image: %v", err)
+	}
+
+	info := pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: "PNG"}, &converted)
+	if pdf.Err() {
+		err := pdf.Error()
+		pdf.ClearError()
+		return nil, "", fmt.Errorf("failed to embed image: %v", err)
+	}
+	return info, "PNG", nil
+}
+
+// importPDFPages appends every page of the PDF at pdfPath to the document, keeping the original page size.
+// The page count is passed to reserve before any page is imported.
+func importPDFPages(pdf *gofpdf.Fpdf, importer *gofpdi.Importer, pdfPath string, pageW, pageH float64, reserve func(n int) error) (count int, err error) {
+	pageSizes, err := PDFPageSizes(pdfPath)
+	if err != nil {
+		return 0, err
+	}
+	if err := reserve(len(pageSizes)); err != nil {
+		return 0, err
+	}
+
+	// gofpdi panics on malformed documents, turn that into an error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed PDF document: %v", r)
+		}
+	}()
+
+	importer.SetSourceFile(pdfPath)
+	for pageNo, size := range pageSizes {
+		tpl := importer.ImportPage(pageNo+1, "/MediaBox")
+		// The page's objects are added to the document under hashes that gofpdf replaces with object IDs
+		pdf.ImportTemplates(importer.PutFormXobjectsUnordered())
+		pdf.ImportObjects(importer.GetImportedObjectsUnordered())
+		pdf.ImportObjPos(importer.GetImportedObjHashPos())
+
+		// Page boxes are reported in points, the document uses millimetres
+		w, h := pageW, pageH
+		if size.Width > 0 && size.Height > 0 {
+			w, h = size.Width*pointToMM, size.Height*pointToMM
+		}
+
+		pdf.AddPageFormat("P", gofpdf.SizeType{Wd: w, Ht: h})
+		pdf.UseImportedTemplate(importer.UseTemplate(tpl, 0, 0, w, h))
+	}
+
+	if err := pdf.Error(); err != nil {
+		return 0, err
+	}
+
+	return len(pageSizes), nil
+}
+
+// PageSize is the size of a PDF page in points
+type PageSize struct {
+	Width  float64
+	Height float64
+}
+
+// Pixels returns the number of pixels of the page rendered at dpi, a point being 1/72 inch
+func (s PageSize) Pixels(dpi int) float64 {
+	return s.Width * float64(dpi) / 72 * s.Height * float64(dpi) / 72
+}
+
+// PDFPageSizes returns the MediaBox of every page of the PDF document at path, in page order.
+// It only reads the document structure, so it is cheap enough to check limits before rendering.
+func PDFPageSizes(path string) (sizes []PageSize, err error) {
+	// gofpdi panics on malformed documents, turn that into an error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed PDF document: %v", r)
+		}
+	}()
+
+	importer := gofpdi.NewImporter()
+	importer.SetSourceFile(path)
+	pageSizes := importer.GetPageSizes()
+	if len(pageSizes) == 0 {
+		return nil, fmt.Errorf("document has no pages")
+	}
+
+	sizes = make([]PageSize, len(pageSizes))
+	for pageNo := 1; pageNo <= len(pageSizes); pageNo++ {
+		box := pageSizes[pageNo]["/MediaBox"]
+		sizes[pageNo-1] = PageSize{Width: box["w"], Height: box["h"]}
+	}
+	return sizes, nil
+}
+
+// calculateOptimalDimensions calculates optimal image dimensions based on fit option
+func calculateOptimalDimensions(imgW, imgH, usableW, usableH float64, fit bool) (float64, float64) {
+	newW, newH := imgW, imgH
+
+	// If image is larger than usable area, scale it down
+	if imgW > usableW || imgH > usableH {
+		ratio := min(usableW/imgW, usableH/imgH)
+		newW = imgW * ratio
+		newH = imgH * ratio
+	} else if fit {
+		// If fit is enabled and image is smaller, scale it up to fit the area
+		ratio := min(usableW/imgW, usableH/imgH)
+		newW = imgW * ratio
+		newH = imgH * ratio
+	}
+
+	return newW, newH
+}
+
+// calculatePosition calculates image position based on position option
+func calculatePosition(pos string, areaW, areaH, imgW, imgH float64) (float64, float64) {
+	var x, y float64
+
+	switch strings.ToLower(pos) {
+	case "top-left":
+		x, y = 0, 0
+	case "top-center", "top":
+		x, y = (areaW-imgW)/2, 0
+	case "top-right":
+		x, y = areaW-imgW, 0
+	case "center-left", "left":
+		x, y = 0, (areaH-imgH)/2
+	case "center", "center-center", "":
+		x, y = (areaW-imgW)/2, (areaH-imgH)/2
+	case "center-right", "right":
+		x, y = areaW-imgW, (areaH-imgH)/2
+	case "bottom-left":
+		x, y = 0, areaH-imgH
+	case "bottom-center", "bottom":
+		x, y = (areaW-imgW)/2, areaH-imgH
+	case "bottom-right":
+		x, y = areaW-imgW, areaH-imgH
+	default:
+		// Default to center
+		x, y = (areaW-imgW)/2, (areaH-imgH)/2
+	}
+
+	return x, y
+}
@@ -0,0 +1,228 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/phpdave11/gofpdi"
+)
+
+// testPDF returns a PDF document with the given number of A4 pages
+func testPDF(t *testing.T, pages int) []byte {
+	t.Helper()
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	for i := 0; i < pages; i++ {
+		pdf.AddPage()
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatalf("failed to create test PDF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestConvertPDFPageLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		pages    int
+		maxPages int
+		wantErr  error
+	}{
+		{name: "within limit", pages: 3, maxPages: 3},
+		{name: "unlimited", pages: 3},
+		{name: "over limit", pages: 3, maxPages: 2, wantErr: ErrTooManyPages},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := []ImageSource{{Name: "doc.pdf", ContentType: PDFContentType, Reader: bytes.NewReader(testPDF(t, tt.pages))}}
+			report, err := Convert(context.Background(), sources, Options{TempDir: t.TempDir(), MaxPages: tt.maxPages}, io.Discard)
+			if err != tt.wantErr {
+				t.Fatalf("Convert() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && report.Pages != tt.pages {
+				t.Errorf("Convert() pages = %d, want %d", report.Pages, tt.pages)
+			}
+		})
+	}
+}
+
+func TestPDFPageSizes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.pdf")
+	if err := os.WriteFile(path, testPDF(t, 2), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sizes, err := PDFPageSizes(path)
+	if err != nil {
+		t.Fatalf("PDFPageSizes() error = %v", err)
+	}
+	if len(sizes) != 2 {
+		t.Fatalf("PDFPageSizes() returned %d pages, want 2", len(sizes))
+	}
+	// A4 is 210x297 mm, 595x842 points
+	if math.Abs(sizes[0].Width-595.28) > 1 || math.Abs(sizes[0].Height-841.89) > 1 {
+		t.Errorf("PDFPageSizes() page 1 = %+v, want A4", sizes[0])
+	}
+}
+
+func TestConvertPDFPageSize(t *testing.T) {
+	tests := []struct {
+		pageSize    string
+		orientation string
+		wantW       float64
+		wantH       float64
+	}{
+		{pageSize: "", orientation: "P", wantW: 595.28, wantH: 841.89},
+		{pageSize: "A4", orientation: "L", wantW: 841.89, wantH: 595.28},
+		{pageSize: "a3", orientation: "P", wantW: 841.89, wantH: 1190.55},
+		{pageSize: "A5", orientation: "P", wantW: 419.53, wantH: 595.28},
+		{pageSize: "Letter", orientation: "P", wantW: 612, wantH: 792},
+		{pageSize: "Legal", orientation: "L", wantW: 1008, wantH: 612},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pageSize+" "+tt.orientation, func(t *testing.T) {
+			sources := []ImageSource{{Name: "a.png", Reader: bytes.NewReader(testImage(t, "png", 40, 20))}}
+			var buf bytes.Buffer
+			_, err := Convert(context.Background(), sources, Options{PageSize: tt.pageSize, Orientation: tt.orientation, TempDir: t.TempDir()}, &buf)
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+
+			path := filepath.Join(t.TempDir(), "out.pdf")
+			if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			sizes, err := PDFPageSizes(path)
+			if err != nil {
+				t.Fatalf("PDFPageSizes() error = %v", err)
+			}
+			if len(sizes) != 1 || math.Abs(sizes[0].Width-tt.wantW) > 1 || math.Abs(sizes[0].Height-tt.wantH) > 1 {
+				t.Errorf("page sizes = %+v, want %.0fx%.0f points", sizes, tt.wantW, tt.wantH)
+			}
+		})
+	}
+
+	sources := []ImageSource{{Name: "a.png", Reader: bytes.NewReader(testImage(t, "png", 40, 20))}}
+	if _, err := Convert(context.Background(), sources, Options{PageSize: "B5", TempDir: t.TempDir()}, io.Discard); err == nil {
+		t.Error("Convert() with page size B5 error = nil, want an error")
+	}
+}
+
+func TestPDFPageSizesMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4\nnot a document"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := PDFPageSizes(path); err == nil {
+		t.Fatal("PDFPageSizes() error = nil, want an error for a malformed document")
+	}
+}
+
+// countingRasterizer renders nothing and counts how often it is called
+type countingRasterizer struct {
+	calls int
+}
+
+func (r *countingRasterizer) Rasterize(ctx context.Context, pdfPath, outDir, format string, dpi int) ([]string, error) {
+	r.calls++
+	return nil, errors.New("not implemented")
+}
+
+func TestConvertRasterPageLimitBeforeRendering(t *testing.T) {
+	rasterizer := &countingRasterizer{}
+	sources := []ImageSource{{Name: "doc.pdf", ContentType: PDFContentType, Reader: bytes.NewReader(testPDF(t, 3))}}
+
+	_, err := Convert(context.Background(), sources, Options{
+		Format:     FormatTIFF,
+		Rasterizer: rasterizer,
+		TempDir:    t.TempDir(),
+		MaxPages:   2,
+	}, io.Discard)
+	if err != ErrTooManyPages {
+		t.Fatalf("Convert() error = %v, want %v", err, ErrTooManyPages)
+	}
+	if rasterizer.calls != 0 {
+		t.Errorf("rasterizer called %d times, want 0", rasterizer.calls)
+	}
+}
+
+func TestImportPDFPagesReservesBeforeImporting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.pdf")
+	if err := os.WriteFile(path, testPDF(t, 3), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// An empty document, compared with one that went through a refused import
+	output := func(pdf *gofpdf.Fpdf) []byte {
+		t.Helper()
+		pdf.AddPage()
+		var buf bytes.Buffer
+		if err := pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	newPDF := func() *gofpdf.Fpdf {
+		pdf := gofpdf.New("P", "mm", "A4", "")
+		pdf.SetCatalogSort(true)
+		pdf.SetCreationDate(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		return pdf
+	}
+
+	pdf := newPDF()
+	reserved := 0
+	_, err := importPDFPages(pdf, gofpdi.NewImporter(), path, 210, 297, func(n int) error {
+		reserved = n
+		return ErrTooManyPages
+	})
+	if err != ErrTooManyPages || reserved != 3 {
+		t.Fatalf("importPDFPages() error = %v after reserving %d pages, want %v after 3", err, reserved, ErrTooManyPages)
+	}
+	if !bytes.Equal(output(pdf), output(newPDF())) {
+		t.Error("refused import added content to the document")
+	}
+}
+
+func TestConvertRasterPagePixelsBeforeRendering(t *testing.T) {
+	// An A4 page is about 2.2 megapixels at 150 DPI and 34.8 megapixels at 600 DPI
+	tests := []struct {
+		name      string
+		dpi       int
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "within limit", dpi: 150, wantCalls: 1},
+		{name: "over limit", dpi: 600, wantErr: ErrPageTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rasterizer := &countingRasterizer{}
+			sources := []ImageSource{{Name: "doc.pdf", ContentType: PDFContentType, Reader: bytes.NewReader(testPDF(t, 1))}}
+
+			_, err := Convert(context.Background(), sources, Options{
+				Format:        FormatTIFF,
+				DPI:           tt.dpi,
+				Rasterizer:    rasterizer,
+				TempDir:       t.TempDir(),
+				MaxPagePixels: 10e6,
+			}, io.Discard)
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Convert() error = %v, want %v", err, tt.wantErr)
+			}
+			if rasterizer.calls != tt.wantCalls {
+				t.Errorf("rasterizer called %d times, want %d", rasterizer.calls, tt.wantCalls)
+			}
+		})
+	}
+}
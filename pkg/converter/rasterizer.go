@@ -0,0 +1,68 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Rasterizer renders the pages of a PDF document to image files
+type Rasterizer interface {
+	// Rasterize renders every page of pdfPath into outDir and returns the image paths in page order
+	Rasterize(ctx context.Context, pdfPath, outDir, format string, dpi int) ([]string, error)
+}
+
+// PopplerRasterizer renders PDF pages with the local pdftoppm binary from poppler-utils
+type PopplerRasterizer struct {
+	binary string
+}
+
+// NewPopplerRasterizer creates a rasterizer that runs the given pdftoppm binary
+func NewPopplerRasterizer(binary string) *PopplerRasterizer {
+	return &PopplerRasterizer{
+		binary: binary,
+	}
+}
+
+// Rasterize renders the pages of pdfPath as PNG or JPEG files named page-N in outDir.
+// The pdftoppm process is killed when ctx is cancelled.
+func (r *PopplerRasterizer) Rasterize(ctx context.Context, pdfPath, outDir, format string, dpi int) ([]string, error) {
+	var formatFlag, ext string
+	switch format {
+	case "png":
+		formatFlag, ext = "-png", "png"
+	case "jpeg":
+		formatFlag, ext = "-jpeg", "jpg"
+	default:
+		return nil, fmt.Errorf("unsupported image format: %s", format)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, r.binary, formatFlag, "-r", strconv.Itoa(dpi), pdfPath, filepath.Join(outDir, "page"))
+	cmd.Stderr = &stderr
+	// Don't wait for stray child processes that keep stderr open after a kill
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("%s failed: %v: %s", r.binary, err, stderr.String())
+	}
+
+	// pdftoppm zero-pads page numbers to the same width, so lexical order is page order
+	pages, err := filepath.Glob(filepath.Join(outDir, "page-*."+ext))
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("%s produced no pages", r.binary)
+	}
+	sort.Strings(pages)
+
+	return pages, nil
+}
@@ -0,0 +1,223 @@
+package converter
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+)
+
+// TIFF tag identifiers used by the multipage writer
+const (
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagPhotometric     = 262
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagStripByteCounts = 279
+	tiffTagXResolution     = 282
+	tiffTagYResolution     = 283
+	tiffTagPlanarConfig    = 284
+	tiffTagResolutionUnit  = 296
+)
+
+// TIFF field types used by the multipage writer
+const (
+	tiffTypeShort    = 3
+	tiffTypeLong     = 4
+	tiffTypeRational = 5
+)
+
+// tiffEntryCount is the number of IFD entries written for every page
+const tiffEntryCount = 13
+
+// tiffEntry is a single IFD entry whose value fits in the 4 byte value field
+type tiffEntry struct {
+	tag, fieldType uint16
+	count, value   uint32
+}
+
+// tiffPage is a compressed page waiting to be written
+type tiffPage struct {
+	width, height int
+	strip         []byte
+}
+
+// multipageTIFFWriter writes RGB pages as a little-endian multipage TIFF to a plain io.Writer.
+// Every page is laid out as IFD, extra values and one Deflate compressed strip. A page is held
+// back until the next one arrives, so its IFD can point to the next IFD without seeking.
+type multipageTIFFWriter struct {
+	w       io.Writer
+	dpi     uint32
+	offset  uint32
+	pending *tiffPage
+	pages   int
+}
+
+// newMultipageTIFFWriter writes the TIFF header and returns a writer for the pages
+func newMultipageTIFFWriter(w io.Writer, dpi int) (*multipageTIFFWriter, error) {
+	tw := &multipageTIFFWriter{w: w, dpi: uint32(dpi)}
+
+	// Byte order, magic number and the offset of the first IFD, which directly follows the header
+	header := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	if err := tw.write(header); err != nil {
+		return nil, err
+	}
+
+	return tw, nil
+}
+
+// AddPage appends img as a new page
+func (tw *multipageTIFFWriter) AddPage(img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Pixel data as one compressed RGB strip
+	var strip bytes.Buffer
+	zw := zlib.NewWriter(&strip)
+	row := make([]byte, width*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			i := (x - bounds.Min.X) * 3
+			row[i], row[i+1], row[i+2] = byte(r>>8), byte(g>>8), byte(b>>8)
+		}
+		if _, err := zw.Write(row); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if tw.pending != nil {
+		if err := tw.flush(true); err != nil {
+			return err
+		}
+	}
+	tw.pending = &tiffPage{width: width, height: height, strip: strip.Bytes()}
+	tw.pages++
+
+	return nil
+}
+
+// Close writes the last page, which ends the IFD chain
+func (tw *multipageTIFFWriter) Close() error {
+	if tw.pending == nil {
+		return fmt.Errorf("TIFF has no pages")
+	}
+	return tw.flush(false)
+}
+
+// Pages returns the number of pages added so far
+func (tw *multipageTIFFWriter) Pages() int {
+	return tw.pages
+}
+
+// flush writes the pending page. When more pages follow, its IFD links to the next IFD,
+// which starts right after the page data.
+func (tw *multipageTIFFWriter) flush(hasNext bool) error {
+	page := tw.pending
+	tw.pending = nil
+
+	ifdOffset := tw.offset
+	ifdSize := uint32(2 + tiffEntryCount*12 + 4)
+	bitsOffset := ifdOffset + ifdSize
+	resolutionOffset := bitsOffset + 8 // 3 SHORTs padded to a word boundary
+	stripOffset := resolutionOffset + 8
+	stripSize := uint32(len(page.strip))
+
+	var nextIFD uint32
+	if hasNext {
+		nextIFD = stripOffset + stripSize
+		nextIFD += nextIFD % 2 // IFDs start on a word boundary
+	}
+
+	// Entries must be sorted by tag
+	entries := []tiffEntry{
+		{tiffTagImageWidth, tiffTypeLong, 1, uint32(page.width)},
+		{tiffTagImageLength, tiffTypeLong, 1, uint32(page.height)},
+		{tiffTagBitsPerSample, tiffTypeShort, 3, bitsOffset},
+		{tiffTagCompression, tiffTypeShort, 1, 8}, // Adobe Deflate
+		{tiffTagPhotometric, tiffTypeShort, 1, 2}, // RGB
+		{tiffTagStripOffsets, tiffTypeLong, 1, stripOffset},
+		{tiffTagSamplesPerPixel, tiffTypeShort, 1, 3},
+		{tiffTagRowsPerStrip, tiffTypeLong, 1, uint32(page.height)},
+		{tiffTagStripByteCounts, tiffTypeLong, 1, stripSize},
+		{tiffTagXResolution, tiffTypeRational, 1, resolutionOffset},
+		{tiffTagYResolution, tiffTypeRational, 1, resolutionOffset},
+		{tiffTagPlanarConfig, tiffTypeShort, 1, 1},   // Chunky
+		{tiffTagResolutionUnit, tiffTypeShort, 1, 2}, // Inch
+	}
+
+	buf := make([]byte, 0, int(ifdSize)+16)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(entries)))
+	for _, e := range entries {
+		buf = binary.LittleEndian.AppendUint16(buf, e.tag)
+		buf = binary.LittleEndian.AppendUint16(buf, e.fieldType)
+		buf = binary.LittleEndian.AppendUint32(buf, e.count)
+		// SHORT values are left-justified in the value field
+		if e.fieldType == tiffTypeShort && e.count == 1 {
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(e.value))
+			buf = append(buf, 0, 0)
+		} else {
+			buf = binary.LittleEndian.AppendUint32(buf, e.value)
+		}
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, nextIFD)
+
+	// Values that don't fit in an IFD entry: bits per sample and the resolution rational
+	buf = binary.LittleEndian.AppendUint16(buf, 8)
+	buf = binary.LittleEndian.AppendUint16(buf, 8)
+	buf = binary.LittleEndian.AppendUint16(buf, 8)
+	buf = append(buf, 0, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, tw.dpi)
+	buf = binary.LittleEndian.AppendUint32(buf, 1)
+
+	if err := tw.write(buf); err != nil {
+		return err
+	}
+	if err := tw.write(page.strip); err != nil {
+		return err
+	}
+	if hasNext && tw.offset%2 != 0 {
+		return tw.write([]byte{0})
+	}
+	return nil
+}
+
+// write appends data at the current offset
+func (tw *multipageTIFFWriter) write(data []byte) error {
+	n, err := tw.w.Write(data)
+	tw.offset += uint32(n)
+	return err
+}
+
+// writeTIFF creates a multipage TIFF with one page per image or rendered PDF page
+func (c *conversion) writeTIFF(sources []ImageSource, w io.Writer) error {
+	// Pages are encoded into memory first, so nothing partial reaches w when a source fails
+	var out bytes.Buffer
+	writer, err := newMultipageTIFFWriter(&out, c.opts.DPI)
+	if err != nil {
+		return fmt.Errorf("failed to write TIFF header: %v", err)
+	}
+
+	if err := c.forEachPageImage(sources, writer.AddPage); err != nil {
+		return err
+	}
+	endStep := c.startStep("converter.output", map[string]any{"pages": c.report.Pages})
+	err = writer.Close()
+	if err == nil {
+		_, err = out.WriteTo(w)
+	}
+	endStep(err)
+	if err != nil {
+		return fmt.Errorf("failed to write TIFF: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// testImage returns an image of the given size encoded as PNG or JPEG
+func testImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatalf("failed to encode %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+// decodeTIFFPages decodes every page of a little-endian multipage TIFF. The decoder only
+// reads the first IFD, so each page is decoded from a copy whose header points at its IFD.
+func decodeTIFFPages(t *testing.T, data []byte) []image.Image {
+	t.Helper()
+	if len(data) < 8 || string(data[:4]) != "II*\x00" {
+		t.Fatalf("not a little-endian TIFF: % x", data[:min(len(data), 8)])
+	}
+
+	var pages []image.Image
+	for offset := binary.LittleEndian.Uint32(data[4:8]); offset != 0; {
+		if int(offset)+2 > len(data) || len(pages) > 100 {
+			t.Fatalf("invalid IFD offset %d", offset)
+		}
+		page := bytes.Clone(data)
+		binary.LittleEndian.PutUint32(page[4:8], offset)
+		img, err := tiff.Decode(bytes.NewReader(page))
+		if err != nil {
+			t.Fatalf("failed to decode page %d: %v", len(pages)+1, err)
+		}
+		pages = append(pages, img)
+
+		// The offset of the next IFD follows the 12-byte entries
+		entries := int(binary.LittleEndian.Uint16(data[offset:]))
+		next := int(offset) + 2 + entries*12
+		offset = binary.LittleEndian.Uint32(data[next : next+4])
+	}
+	return pages
+}
+
+func TestConvertTIFFRoundTrip(t *testing.T) {
+	sources := []ImageSource{
+		{Name: "wide.png", Reader: bytes.NewReader(testImage(t, "png", 40, 20))},
+		{Name: "broken.png", ContentType: "image/png", Reader: bytes.NewReader([]byte("not an image"))},
+		{Name: "tall.jpg", Reader: bytes.NewReader(testImage(t, "jpeg", 16, 48))},
+	}
+
+	var out bytes.Buffer
+	report, err := Convert(context.Background(), sources, Options{Format: FormatTIFF, TempDir: t.TempDir()}, &out)
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if report.Pages != 2 || !report.Sources[1].Skipped {
+		t.Errorf("report = %+v, want 2 pages with the broken source skipped", report)
+	}
+
+	pages := decodeTIFFPages(t, out.Bytes())
+	want := []image.Point{{40, 20}, {16, 48}}
+	if len(pages) != len(want) {
+		t.Fatalf("TIFF has %d pages, want %d", len(pages), len(want))
+	}
+	for i, page := range pages {
+		if size := page.Bounds().Size(); size != want[i] {
+			t.Errorf("page %d is %v, want %v", i+1, size, want[i])
+		}
+	}
+}
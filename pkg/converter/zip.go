@@ -0,0 +1,37 @@
+package converter
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"time"
+)
+
+// writeZIP creates a ZIP archive of the sources normalised to numbered PNG pages.
+// Pages are encoded straight into the archive, so w receives data while the conversion runs.
+func (c *conversion) writeZIP(sources []ImageSource, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	err := c.forEachPageImage(sources, func(img image.Image) error {
+		// PNG is already compressed, storing it avoids wasted CPU
+		dst, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     fmt.Sprintf("page_%03d.png", c.report.Pages),
+			Method:   zip.Store,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		return png.Encode(dst, img)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write ZIP archive: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"image/png"
+	"testing"
+)
+
+func TestConvertZIPEntries(t *testing.T) {
+	sources := []ImageSource{
+		{Name: "first.png", Reader: bytes.NewReader(testImage(t, "png", 30, 10))},
+		{Name: "second.jpg", Reader: bytes.NewReader(testImage(t, "jpeg", 8, 24))},
+		{Name: "third.png", Reader: bytes.NewReader(testImage(t, "png", 5, 5))},
+	}
+
+	var out bytes.Buffer
+	report, err := Convert(context.Background(), sources, Options{Format: FormatZIP, TempDir: t.TempDir()}, &out)
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if report.Pages != 3 {
+		t.Errorf("report pages = %d, want 3", report.Pages)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("output is not a ZIP archive: %v", err)
+	}
+	wantNames := []string{"page_001.png", "page_002.png", "page_003.png"}
+	wantWidths := []int{30, 8, 5}
+	if len(archive.File) != len(wantNames) {
+		t.Fatalf("archive has %d entries, want %d", len(archive.File), len(wantNames))
+	}
+	for i, file := range archive.File {
+		if file.Name != wantNames[i] {
+			t.Errorf("entry %d is %s, want %s", i, file.Name, wantNames[i])
+		}
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", file.Name, err)
+		}
+		img, err := png.Decode(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s is not a PNG: %v", file.Name, err)
+		}
+		if width := img.Bounds().Dx(); width != wantWidths[i] {
+			t.Errorf("%s is %d pixels wide, want %d", file.Name, width, wantWidths[i])
+		}
+	}
+}